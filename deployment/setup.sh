@@ -7,6 +7,23 @@
 
 DDNS_IP=$(curl icanhazip.com)
 
+# Allow signed updates if a TSIG key is configured
+DDNS_UPDATE_ACL="localhost;"
+if [ -n "$DDNS_TSIG_KEY_NAME" ] && [ -n "$DDNS_TSIG_SECRET" ]
+then
+	if ! grep 'key "'$DDNS_TSIG_KEY_NAME'"' /etc/bind/named.conf > /dev/null
+	then
+		echo "creating tsig key...";
+		cat >> /etc/bind/named.conf <<EOF
+key "$DDNS_TSIG_KEY_NAME" {
+	algorithm hmac-sha256;
+	secret "$DDNS_TSIG_SECRET";
+};
+EOF
+	fi
+	DDNS_UPDATE_ACL="localhost; key $DDNS_TSIG_KEY_NAME;"
+fi
+
 for d in ${DDNS_DOMAINS//,/ }
 do
 	if ! grep 'zone "'$d'"' /etc/bind/named.conf > /dev/null
@@ -17,8 +34,8 @@ zone "$d" {
 	type master;
 	file "$d.zone";
 	allow-query { any; };
-	allow-transfer { none; };
-	allow-update { localhost; };
+	allow-transfer { $DDNS_UPDATE_ACL };
+	allow-update { $DDNS_UPDATE_ACL };
 };
 EOF
 	fi
@@ -0,0 +1,322 @@
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/nswrapper"
+	"github.com/labstack/gommon/log"
+	"github.com/miekg/dns"
+	acmeapi "golang.org/x/crypto/acme"
+)
+
+// LetsEncryptURL is the directory of the Let's Encrypt production CA.
+const LetsEncryptURL = acmeapi.LetsEncryptURL
+
+// challengeTtl is the ttl of the challenge TXT records.
+const challengeTtl = 60
+
+// Manager obtains and renews a certificate for Domains from an ACME CA.
+// The DNS-01 challenges are answered by adding TXT records through Backend,
+// so every domain has to be within one of Zones.
+// The account key, certificate and private key are kept in Dir.
+type Manager struct {
+	Domains          []string
+	Zones            []string
+	Email            string
+	CA               string
+	Dir              string
+	Backend          nswrapper.DNSBackend
+	PropagationDelay time.Duration
+	RenewBefore      time.Duration
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+}
+
+// GetCertificate returns the current certificate, it is meant for tls.Config.
+func (m *Manager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.cert == nil {
+		return nil, errors.New("no certificate has been obtained yet")
+	}
+
+	return m.cert, nil
+}
+
+// Load reads a previously obtained certificate from Dir, a missing certificate is no error.
+func (m *Manager) Load() error {
+	cert, err := tls.LoadX509KeyPair(m.path("cert.pem"), m.path("key.pem"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.cert = &cert
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Renew obtains a new certificate, if there is none, it doesn't cover Domains
+// or it expires within RenewBefore.
+func (m *Manager) Renew(ctx context.Context) error {
+	if !m.needsRenewal(time.Now()) {
+		return nil
+	}
+
+	log.Info("Requesting certificate for ", strings.Join(m.Domains, ", "))
+	cert, err := m.obtain(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.cert = cert
+	m.mu.Unlock()
+	log.Info("Certificate obtained, valid until ", cert.Leaf.NotAfter.Format(time.RFC3339))
+
+	return nil
+}
+
+// needsRenewal reports whether the current certificate has to be replaced at now.
+func (m *Manager) needsRenewal(now time.Time) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.cert == nil || m.cert.Leaf == nil || now.Add(m.RenewBefore).After(m.cert.Leaf.NotAfter) {
+		return true
+	}
+
+	for _, domain := range m.Domains {
+		if m.cert.Leaf.VerifyHostname(strings.Replace(domain, "*", "wildcard", 1)) != nil {
+			return true
+		}
+	}
+
+	return false
+}
+
+// obtain runs a complete ACME order and stores the issued certificate in Dir.
+func (m *Manager) obtain(ctx context.Context) (*tls.Certificate, error) {
+	accountKey, err := m.loadKey("account.key")
+	if err != nil {
+		return nil, err
+	}
+
+	client := &acmeapi.Client{Key: accountKey, DirectoryURL: m.CA}
+	account := &acmeapi.Account{}
+	if m.Email != "" {
+		account.Contact = []string{"mailto:" + m.Email}
+	}
+	if _, err = client.Register(ctx, account, acmeapi.AcceptTOS); err != nil && !errors.Is(err, acmeapi.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("registering acme account: %w", err)
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acmeapi.DomainIDs(m.Domains...))
+	if err != nil {
+		return nil, fmt.Errorf("creating acme order: %w", err)
+	}
+
+	// only the response to the order creation carries its url
+	orderURL := order.URI
+	for _, authzURL := range order.AuthzURLs {
+		if err = m.authorize(ctx, client, authzURL); err != nil {
+			return nil, err
+		}
+	}
+
+	if order, err = client.WaitOrder(ctx, orderURL); err != nil {
+		return nil, fmt.Errorf("waiting for acme order: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: m.Domains}, key)
+	if err != nil {
+		return nil, err
+	}
+
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		// CAs issuing in the background need not return the order url on finalization,
+		// so the order is polled by its known url instead
+		if order, err = client.WaitOrder(ctx, orderURL); err != nil {
+			return nil, fmt.Errorf("finalizing acme order: %w", err)
+		}
+		if chain, err = client.FetchCert(ctx, order.CertURL, true); err != nil {
+			return nil, fmt.Errorf("fetching certificate: %w", err)
+		}
+	}
+
+	return m.store(chain, key)
+}
+
+// authorize answers the DNS-01 challenge of a single authorization.
+func (m *Manager) authorize(ctx context.Context, client *acmeapi.Client, authzURL string) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acmeapi.StatusValid {
+		return nil
+	}
+
+	var challenge *acmeapi.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			challenge = c
+			break
+		}
+	}
+	if challenge == nil {
+		return fmt.Errorf("no dns-01 challenge offered for %s", authz.Identifier.Value)
+	}
+
+	value, err := client.DNS01ChallengeRecord(challenge.Token)
+	if err != nil {
+		return err
+	}
+
+	hostname, zone, err := m.challengeName(authz.Identifier.Value)
+	if err != nil {
+		return err
+	}
+
+	target := `"` + value + `"`
+	if err = m.Backend.AddRecord(hostname, target, "TXT", zone, challengeTtl); err != nil {
+		return fmt.Errorf("adding challenge record: %w", err)
+	}
+	defer func() {
+		if err := m.Backend.RemoveRecord(hostname, target, "TXT", zone); err != nil {
+			log.Error("Error removing challenge record: ", err)
+		}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(m.PropagationDelay):
+	}
+
+	if _, err = client.Accept(ctx, challenge); err != nil {
+		return fmt.Errorf("accepting challenge of %s: %w", authz.Identifier.Value, err)
+	}
+
+	if _, err = client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("authorizing %s: %w", authz.Identifier.Value, err)
+	}
+
+	return nil
+}
+
+// challengeName returns the hostname of the challenge record of domain within its zone.
+func (m *Manager) challengeName(domain string) (string, string, error) {
+	name := "_acme-challenge." + strings.ToLower(strings.TrimPrefix(domain, "*."))
+
+	zone := ""
+	for _, z := range m.Zones {
+		z = strings.ToLower(strings.TrimSuffix(z, "."))
+		if dns.IsSubDomain(z, name) && len(z) > len(zone) {
+			zone = z
+		}
+	}
+	if zone == "" {
+		return "", "", fmt.Errorf("%s is not within a served zone", domain)
+	}
+
+	return strings.TrimSuffix(name, "."+zone), zone, nil
+}
+
+// store writes chain and key to Dir and returns them as certificate.
+func (m *Manager) store(chain [][]byte, key *ecdsa.PrivateKey) (*tls.Certificate, error) {
+	certPEM := []byte{}
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	if err = os.MkdirAll(m.Dir, 0700); err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(m.path("key.pem"), keyPEM, 0600); err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(m.path("cert.pem"), certPEM, 0644); err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+
+	return &cert, err
+}
+
+// loadKey reads the private key name from Dir and generates it, if it doesn't exist.
+func (m *Manager) loadKey(name string) (crypto.Signer, error) {
+	data, err := os.ReadFile(m.path(name))
+	if err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s is not a pem file", m.path(name))
+		}
+
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(m.Dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return key, os.WriteFile(m.path(name), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600)
+}
+
+func (m *Manager) path(name string) string {
+	return filepath.Join(m.Dir, name)
+}
@@ -0,0 +1,84 @@
+package acme
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// selfSigned stores a certificate for names valid until notAfter in m.Dir.
+func selfSigned(t *testing.T, m *Manager, notAfter time.Time, names ...string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: names[0]},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	if _, err = m.store([][]byte{der}, key); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+}
+
+func TestChallengeNameToSplitLongestZone(t *testing.T) {
+	m := &Manager{Zones: []string{"example.com", "dyndns.example.com"}}
+
+	hostname, zone, err := m.challengeName("*.Blog.dyndns.example.com")
+	if err != nil || hostname != "_acme-challenge.blog" || zone != "dyndns.example.com" {
+		t.Fatalf("Expected _acme-challenge.blog in dyndns.example.com but got %s in %s: %v", hostname, zone, err)
+	}
+
+	hostname, zone, err = m.challengeName("dyndns.example.com")
+	if err != nil || hostname != "_acme-challenge" || zone != "dyndns.example.com" {
+		t.Fatalf("Expected _acme-challenge in dyndns.example.com but got %s in %s: %v", hostname, zone, err)
+	}
+
+	if _, _, err = m.challengeName("example.org"); err == nil {
+		t.Fatal("Expected error for a foreign domain")
+	}
+}
+
+func TestLoadToRenewOnlyExpiringOrMismatchingCertificates(t *testing.T) {
+	m := &Manager{Domains: []string{"dyndns.example.com", "*.dyndns.example.com"}, Dir: t.TempDir(), RenewBefore: 30 * 24 * time.Hour}
+
+	if err := m.Load(); err != nil || !m.needsRenewal(time.Now()) {
+		t.Fatalf("Expected missing certificate to need renewal: %v", err)
+	}
+	if _, err := m.GetCertificate(nil); err == nil {
+		t.Fatal("Expected error without certificate")
+	}
+
+	selfSigned(t, m, time.Now().Add(90*24*time.Hour), "dyndns.example.com", "*.dyndns.example.com")
+	if err := m.Load(); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if m.needsRenewal(time.Now()) {
+		t.Fatal("Expected valid certificate not to need renewal")
+	}
+	if m.needsRenewal(time.Now().Add(59*24*time.Hour)) || !m.needsRenewal(time.Now().Add(61*24*time.Hour)) {
+		t.Fatal("Expected certificate to need renewal 30 days before it expires")
+	}
+	if cert, err := m.GetCertificate(nil); err != nil || cert.Leaf.DNSNames[0] != "dyndns.example.com" {
+		t.Fatalf("Expected loaded certificate but got %v", err)
+	}
+
+	m.Domains = append(m.Domains, "other.example.com")
+	if !m.needsRenewal(time.Now()) {
+		t.Fatal("Expected certificate without all domains to need renewal")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/handler"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/migrate"
+)
+
+// runMigrate runs the migrate subcommand with args: up (default), down <version> or status.
+func runMigrate(args []string) error {
+	h := &handler.Handler{}
+	if err := h.OpenDB(); err != nil {
+		return err
+	}
+	defer h.Close()
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		return migrate.Up(h.DB)
+	case "down":
+		if len(args) != 2 {
+			return errors.New("usage: migrate down <version>")
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version: %s", args[1])
+		}
+		return migrate.Down(h.DB, version)
+	case "status":
+		version, err := migrate.Version(h.DB)
+		if err != nil {
+			return err
+		}
+		pending, err := migrate.Pending(h.DB)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("schema version %d, latest %d\n", version, migrate.Latest())
+		for _, m := range pending {
+			fmt.Printf("pending %d: %s\n", m.Version, m.Name)
+		}
+		return nil
+	default:
+		return errors.New("usage: migrate [up | down <version> | status]")
+	}
+}
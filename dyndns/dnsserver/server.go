@@ -0,0 +1,557 @@
+package dnsserver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/nswrapper"
+	"github.com/labstack/gommon/log"
+	"github.com/miekg/dns"
+	"gorm.io/gorm"
+)
+
+// maxCNameChain limits how many cnames are followed within the own zones.
+const maxCNameChain = 8
+
+// Server is an authoritative name server answering queries for the dyndns domains
+// straight from the host, cname and record tables.
+// Records added by AddRecord, like ACME challenges, are only kept in memory.
+// It implements nswrapper.DNSBackend, so the handler can use it in place of an external name server.
+type Server struct {
+	DB            *gorm.DB
+	Domains       []string
+	NameServer    string
+	Ttl           int
+	AllowWildcard bool
+
+	mu      sync.Mutex
+	serial  uint32
+	servers []*dns.Server
+	records map[string][]dns.RR
+}
+
+// New creates a built-in name server for the given domains.
+// nameServer is the name published in the SOA and NS records of every zone.
+func New(db *gorm.DB, domains []string, nameServer string, ttl int, allowWildcard bool) *Server {
+	return &Server{
+		DB:            db,
+		Domains:       domains,
+		NameServer:    dns.Fqdn(nameServer),
+		Ttl:           ttl,
+		AllowWildcard: allowWildcard,
+		serial:        uint32(time.Now().Unix()),
+		records:       map[string][]dns.RR{},
+	}
+}
+
+// ListenAndServe answers queries on addr via udp and tcp until Shutdown is called.
+func (s *Server) ListenAndServe(addr string) error {
+	s.mu.Lock()
+	for _, network := range []string{"udp", "tcp"} {
+		s.servers = append(s.servers, &dns.Server{Addr: addr, Net: network, Handler: s})
+	}
+	servers := s.servers
+	s.mu.Unlock()
+
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func(server *dns.Server) {
+			errs <- server.ListenAndServe()
+		}(server)
+	}
+
+	return <-errs
+}
+
+// Shutdown stops all listeners.
+func (s *Server) Shutdown() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for _, server := range s.servers {
+		if shutdownErr := server.Shutdown(); shutdownErr != nil {
+			err = shutdownErr
+		}
+	}
+
+	return err
+}
+
+// UpdateRecord only bumps the zone serial, because the records are served from the database.
+func (s *Server) UpdateRecord(hostname string, target string, addrType string, zone string, ttl int, enableWildcard bool) error {
+	log.Info(fmt.Sprintf("%s record update request: %s -> %s", addrType, hostname, target))
+	s.bumpSerial()
+
+	return nil
+}
+
+// DeleteRecord only bumps the zone serial, because the records are served from the database.
+func (s *Server) DeleteRecord(hostname string, zone string, enableWildcard bool) error {
+	log.Info(fmt.Sprintf("record delete request: %s", hostname))
+	s.bumpSerial()
+
+	return nil
+}
+
+// DeleteRecordType only bumps the zone serial, because the records are served from the database.
+func (s *Server) DeleteRecordType(hostname string, addrType string, zone string, enableWildcard bool) error {
+	log.Info(fmt.Sprintf("%s record delete request: %s", addrType, hostname))
+	s.bumpSerial()
+
+	return nil
+}
+
+// UpdateRecordSet only bumps the zone serial, because the records are served from the database.
+func (s *Server) UpdateRecordSet(hostname string, targets []string, addrType string, zone string, ttl int) error {
+	log.Info(fmt.Sprintf("%s record set update request: %s -> %s", addrType, hostname, strings.Join(targets, ", ")))
+	s.bumpSerial()
+
+	return nil
+}
+
+// AddRecord adds a record, which is served from memory until it is removed.
+func (s *Server) AddRecord(hostname string, target string, addrType string, zone string, ttl int) error {
+	log.Info(fmt.Sprintf("%s record add request: %s -> %s", addrType, hostname, target))
+
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(strings.ToLower(hostname+"."+zone)), ttl, addrType, target))
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := rr.Header().Name
+	for _, existing := range s.records[name] {
+		if dns.IsDuplicate(existing, rr) {
+			return nil
+		}
+	}
+	s.records[name] = append(s.records[name], rr)
+	s.serial++
+
+	return nil
+}
+
+// RemoveRecord removes a record added by AddRecord.
+func (s *Server) RemoveRecord(hostname string, target string, addrType string, zone string) error {
+	log.Info(fmt.Sprintf("%s record remove request: %s -> %s", addrType, hostname, target))
+
+	rr, err := dns.NewRR(fmt.Sprintf("%s 0 IN %s %s", dns.Fqdn(strings.ToLower(hostname+"."+zone)), addrType, target))
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := rr.Header().Name
+	kept := []dns.RR{}
+	for _, existing := range s.records[name] {
+		if !dns.IsDuplicate(existing, rr) {
+			kept = append(kept, existing)
+		}
+	}
+	if len(kept) == 0 {
+		delete(s.records, name)
+	} else {
+		s.records[name] = kept
+	}
+	s.serial++
+
+	return nil
+}
+
+// ListRecords returns all records served for zone.
+func (s *Server) ListRecords(zone string) ([]nswrapper.Record, error) {
+	zone = dns.Fqdn(strings.ToLower(zone))
+	if !s.isZone(zone) {
+		return nil, fmt.Errorf("zone %s is not served", zone)
+	}
+
+	rrs := []dns.RR{s.soa(zone), s.ns(zone)}
+
+	hosts := new([]model.Host)
+	if err := s.DB.Where("lower(domain) = ?", strings.TrimSuffix(zone, ".")).Find(hosts).Error; err != nil {
+		return nil, err
+	}
+
+	for _, host := range *hosts {
+		name := dns.Fqdn(strings.ToLower(host.Hostname) + "." + zone)
+		rrs = append(rrs, hostRRs(name, &host, dns.TypeANY)...)
+	}
+
+	cnames := new([]model.CName)
+	if err := s.DB.Preload("Target").Find(cnames).Error; err != nil {
+		return nil, err
+	}
+
+	for _, cname := range *cnames {
+		if dns.Fqdn(strings.ToLower(cname.Target.Domain)) != zone {
+			continue
+		}
+
+		rrs = append(rrs, cnameRR(dns.Fqdn(strings.ToLower(cname.Hostname)+"."+zone), &cname))
+	}
+
+	hostRecords := new([]model.Record)
+	if err := s.DB.Preload("Host").Joins("JOIN hosts ON hosts.id = records.host_id").
+		Where("lower(hosts.domain) = ?", strings.TrimSuffix(zone, ".")).Find(hostRecords).Error; err != nil {
+		return nil, err
+	}
+
+	for _, record := range *hostRecords {
+		rrs = append(rrs, recordRRs(dns.Fqdn(strings.ToLower(record.Owner())+"."+zone), []model.Record{record}, dns.TypeANY)...)
+	}
+
+	s.mu.Lock()
+	for name, memoryRRs := range s.records {
+		if dns.IsSubDomain(zone, name) {
+			rrs = append(rrs, memoryRRs...)
+		}
+	}
+	s.mu.Unlock()
+
+	records := []nswrapper.Record{}
+	for _, rr := range rrs {
+		header := rr.Header()
+		records = append(records, nswrapper.Record{
+			Name:   header.Name,
+			Ttl:    int(header.Ttl),
+			Type:   dns.TypeToString[header.Rrtype],
+			Target: strings.TrimPrefix(rr.String(), header.String()),
+		})
+	}
+
+	return records, nil
+}
+
+// ServeDNS answers a single query.
+func (s *Server) ServeDNS(w dns.ResponseWriter, r *dns.Msg) {
+	m := new(dns.Msg)
+	m.SetReply(r)
+
+	if len(r.Question) != 1 || r.Question[0].Qclass != dns.ClassINET {
+		m.SetRcode(r, dns.RcodeRefused)
+		w.WriteMsg(m)
+		return
+	}
+
+	q := r.Question[0]
+	qname := strings.ToLower(q.Name)
+	zone := s.findZone(qname)
+	if zone == "" {
+		m.SetRcode(r, dns.RcodeRefused)
+		w.WriteMsg(m)
+		return
+	}
+
+	m.Authoritative = true
+	if err := s.answer(m, qname, q.Qtype, zone); err != nil {
+		log.Error("Error: ", err)
+		m.SetRcode(r, dns.RcodeServerFailure)
+		m.Answer = nil
+	}
+
+	if len(m.Answer) == 0 {
+		m.Ns = []dns.RR{s.soa(zone)}
+	}
+
+	writeMsg(w, r, m)
+}
+
+// writeMsg writes the reply m to the query r.
+// UDP replies are truncated to the buffer size advertised by EDNS0 or 512 bytes,
+// so clients retry over TCP.
+func writeMsg(w dns.ResponseWriter, r *dns.Msg, m *dns.Msg) {
+	size := dns.MinMsgSize
+	if opt := r.IsEdns0(); opt != nil {
+		size = int(opt.UDPSize())
+		if size > dns.DefaultMsgSize {
+			size = dns.DefaultMsgSize
+		}
+		m.SetEdns0(uint16(size), false)
+	}
+
+	if _, udp := w.RemoteAddr().(*net.UDPAddr); udp {
+		m.Truncate(size)
+	}
+
+	w.WriteMsg(m)
+}
+
+// answer adds all records matching qname and qtype to m.
+func (s *Server) answer(m *dns.Msg, qname string, qtype uint16, zone string) error {
+	for i := 0; i < maxCNameChain; i++ {
+		if qname == zone {
+			if qtype == dns.TypeSOA || qtype == dns.TypeANY {
+				m.Answer = append(m.Answer, s.soa(zone))
+			}
+			if qtype == dns.TypeNS || qtype == dns.TypeANY {
+				m.Answer = append(m.Answer, s.ns(zone))
+			}
+
+			return nil
+		}
+
+		if rrs, ok := s.lookupRecords(qname, qtype); ok {
+			m.Answer = append(m.Answer, rrs...)
+
+			return nil
+		}
+
+		label := strings.TrimSuffix(qname, "."+zone)
+
+		host, err := s.lookupHost(label, zone)
+		if err != nil {
+			return err
+		}
+
+		records, err := s.lookupHostRecords(label, zone)
+		if err != nil {
+			return err
+		}
+
+		if host != nil || len(records) > 0 {
+			if host != nil {
+				m.Answer = append(m.Answer, hostRRs(qname, host, qtype)...)
+			}
+			m.Answer = append(m.Answer, recordRRs(qname, records, qtype)...)
+
+			return nil
+		}
+
+		cname, err := s.lookupCName(label, zone)
+		if err != nil {
+			return err
+		}
+		if cname == nil {
+			if len(m.Answer) == 0 {
+				m.Rcode = dns.RcodeNameError
+			}
+
+			return nil
+		}
+
+		m.Answer = append(m.Answer, cnameRR(qname, cname))
+		if qtype == dns.TypeCNAME || qtype == dns.TypeANY {
+			return nil
+		}
+
+		// follow the cname if the target is served by us
+		qname = dns.Fqdn(strings.ToLower(cname.Target.Hostname + "." + cname.Target.Domain))
+		zone = s.findZone(qname)
+		if zone == "" {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// lookupRecords returns the in-memory records of qname matching qtype
+// and whether any records exist for qname.
+func (s *Server) lookupRecords(qname string, qtype uint16) ([]dns.RR, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	all, ok := s.records[qname]
+	rrs := []dns.RR{}
+	for _, rr := range all {
+		if qtype == dns.TypeANY || rr.Header().Rrtype == qtype {
+			rrs = append(rrs, dns.Copy(rr))
+		}
+	}
+
+	return rrs, ok
+}
+
+// lookupHost finds the host entry of label in zone.
+// If wildcards are allowed, subdomains of a host resolve to the host.
+func (s *Server) lookupHost(label string, zone string) (*model.Host, error) {
+	domain := strings.TrimSuffix(zone, ".")
+	for {
+		hosts := new([]model.Host)
+		if err := s.DB.Where("lower(hostname) = ? AND lower(domain) = ?", label, domain).Limit(1).Find(hosts).Error; err != nil {
+			return nil, err
+		}
+
+		if len(*hosts) > 0 {
+			return &(*hosts)[0], nil
+		}
+
+		parts := strings.SplitN(label, ".", 2)
+		if !s.AllowWildcard || len(parts) != 2 {
+			return nil, nil
+		}
+		label = parts[1]
+	}
+}
+
+// lookupHostRecords finds the records of the hosts in zone, which are published at label.
+// Every split of label into record name and hostname is tried, as hostnames may contain dots.
+func (s *Server) lookupHostRecords(label string, zone string) ([]model.Record, error) {
+	domain := strings.TrimSuffix(zone, ".")
+	records := []model.Record{}
+
+	name, hostname := "", label
+	for {
+		found := []model.Record{}
+		err := s.DB.Joins("JOIN hosts ON hosts.id = records.host_id").
+			Where("lower(hosts.hostname) = ? AND lower(hosts.domain) = ? AND lower(records.name) = ?", hostname, domain, name).
+			Find(&found).Error
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, found...)
+
+		parts := strings.SplitN(hostname, ".", 2)
+		if len(parts) != 2 {
+			return records, nil
+		}
+		name = strings.TrimPrefix(name+"."+parts[0], ".")
+		hostname = parts[1]
+	}
+}
+
+// lookupCName finds the cname entry of label in zone.
+func (s *Server) lookupCName(label string, zone string) (*model.CName, error) {
+	cnames := new([]model.CName)
+	if err := s.DB.Preload("Target").Where("lower(hostname) = ?", label).Find(cnames).Error; err != nil {
+		return nil, err
+	}
+
+	for _, cname := range *cnames {
+		if dns.Fqdn(strings.ToLower(cname.Target.Domain)) == zone {
+			return &cname, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// findZone returns the longest served zone qname belongs to.
+func (s *Server) findZone(qname string) string {
+	zone := ""
+	for _, domain := range s.Domains {
+		domain = dns.Fqdn(strings.ToLower(domain))
+		if dns.IsSubDomain(domain, qname) && len(domain) > len(zone) {
+			zone = domain
+		}
+	}
+
+	return zone
+}
+
+func (s *Server) isZone(zone string) bool {
+	for _, domain := range s.Domains {
+		if dns.Fqdn(strings.ToLower(domain)) == zone {
+			return true
+		}
+	}
+
+	return false
+}
+
+// bumpSerial increases the zone serial, which is shared by all zones.
+func (s *Server) bumpSerial() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := uint32(time.Now().Unix())
+	if now > s.serial {
+		s.serial = now
+	} else {
+		s.serial++
+	}
+}
+
+func (s *Server) soa(zone string) dns.RR {
+	s.mu.Lock()
+	serial := s.serial
+	s.mu.Unlock()
+
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: uint32(s.Ttl)},
+		Ns:      s.NameServer,
+		Mbox:    "root." + zone,
+		Serial:  serial,
+		Refresh: 3600,
+		Retry:   900,
+		Expire:  604800,
+		Minttl:  uint32(s.Ttl),
+	}
+}
+
+func (s *Server) ns(zone string) dns.RR {
+	return &dns.NS{
+		Hdr: dns.RR_Header{Name: zone, Rrtype: dns.TypeNS, Class: dns.ClassINET, Ttl: uint32(s.Ttl)},
+		Ns:  s.NameServer,
+	}
+}
+
+// hostRRs returns the address records of host matching qtype.
+func hostRRs(name string, host *model.Host, qtype uint16) []dns.RR {
+	rrs := []dns.RR{}
+
+	if ip := net.ParseIP(host.Ipv4).To4(); ip != nil && (qtype == dns.TypeA || qtype == dns.TypeANY) {
+		rrs = append(rrs, &dns.A{
+			Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: uint32(host.Ttl)},
+			A:   ip,
+		})
+	}
+
+	if ip := net.ParseIP(host.Ipv6); ip != nil && (qtype == dns.TypeAAAA || qtype == dns.TypeANY) {
+		rrs = append(rrs, &dns.AAAA{
+			Hdr:  dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: uint32(host.Ttl)},
+			AAAA: ip,
+		})
+	}
+
+	return rrs
+}
+
+// recordRRs returns the records matching qtype published at name.
+// Records whose data can't be parsed are skipped.
+func recordRRs(name string, records []model.Record, qtype uint16) []dns.RR {
+	rrs := []dns.RR{}
+	for _, record := range records {
+		if qtype != dns.TypeANY && qtype != dns.StringToType[record.Type] {
+			continue
+		}
+
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", name, record.Ttl, record.Type, recordData(&record)))
+		if err != nil {
+			log.Error("Error: invalid ", record.Type, " record at ", name, ": ", err)
+			continue
+		}
+		rrs = append(rrs, rr)
+	}
+
+	return rrs
+}
+
+// recordData returns the presentation format of the data of record.
+func recordData(record *model.Record) string {
+	return nswrapper.RecordData{
+		Type:     record.Type,
+		Value:    record.Value,
+		Priority: record.Priority,
+		Weight:   record.Weight,
+		Port:     record.Port,
+		Flag:     record.Flag,
+		Tag:      record.Tag,
+	}.String()
+}
+
+func cnameRR(name string, cname *model.CName) dns.RR {
+	return &dns.CNAME{
+		Hdr:    dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: uint32(cname.Ttl)},
+		Target: dns.Fqdn(strings.ToLower(cname.Target.Hostname + "." + cname.Target.Domain)),
+	}
+}
@@ -0,0 +1,229 @@
+package dnsserver
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/miekg/dns"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// startTestServer serves a zone with one host and one cname on a random udp port.
+func startTestServer(t *testing.T, allowWildcard bool) (string, *Server) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+
+	if err = db.AutoMigrate(&model.Host{}, &model.CName{}, &model.Record{}); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	host := &model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ipv4: "1.2.3.4", Ipv6: "2001:db8::1", Ttl: 60}
+	db.Create(host)
+	db.Create(&model.CName{Hostname: "www", Target: *host, Ttl: 120})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	s := New(db, []string{"dyndns.example.com"}, "ns.example.com", 3600, allowWildcard)
+	server := &dns.Server{PacketConn: conn, Handler: s}
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+
+	return conn.LocalAddr().String(), s
+}
+
+func query(t *testing.T, addr string, name string, qtype uint16) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+
+	r, err := dns.Exchange(m, addr)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	return r
+}
+
+func TestServeDNSToAnswerHostAddress(t *testing.T) {
+	addr, _ := startTestServer(t, false)
+
+	r := query(t, addr, "Blog.dyndns.example.com.", dns.TypeA)
+	if !r.Authoritative || len(r.Answer) != 1 {
+		t.Fatalf("Expected one authoritative answer but got %v", r)
+	}
+
+	a, ok := r.Answer[0].(*dns.A)
+	if !ok || a.A.String() != "1.2.3.4" || a.Hdr.Ttl != 60 {
+		t.Fatalf("Expected A 1.2.3.4 with ttl 60 but got %v", r.Answer[0])
+	}
+}
+
+func TestServeDNSToAnswerHostIPv6Address(t *testing.T) {
+	addr, _ := startTestServer(t, false)
+
+	r := query(t, addr, "blog.dyndns.example.com.", dns.TypeAAAA)
+	if len(r.Answer) != 1 {
+		t.Fatalf("Expected one answer but got %v", r)
+	}
+
+	if aaaa, ok := r.Answer[0].(*dns.AAAA); !ok || aaaa.AAAA.String() != "2001:db8::1" {
+		t.Fatalf("Expected AAAA 2001:db8::1 but got %v", r.Answer[0])
+	}
+}
+
+func TestServeDNSToFollowCName(t *testing.T) {
+	addr, _ := startTestServer(t, false)
+
+	r := query(t, addr, "www.dyndns.example.com.", dns.TypeA)
+	if len(r.Answer) != 2 {
+		t.Fatalf("Expected cname and address but got %v", r.Answer)
+	}
+
+	if cname, ok := r.Answer[0].(*dns.CNAME); !ok || cname.Target != "blog.dyndns.example.com." {
+		t.Fatalf("Expected cname to blog.dyndns.example.com. but got %v", r.Answer[0])
+	}
+}
+
+func TestServeDNSToReturnNoDataForMissingType(t *testing.T) {
+	addr, _ := startTestServer(t, false)
+
+	r := query(t, addr, "blog.dyndns.example.com.", dns.TypeMX)
+	if r.Rcode != dns.RcodeSuccess || len(r.Answer) != 0 || len(r.Ns) != 1 {
+		t.Fatalf("Expected empty answer with soa but got %v", r)
+	}
+}
+
+func TestServeDNSToReturnNXDomainForUnknownHost(t *testing.T) {
+	addr, _ := startTestServer(t, false)
+
+	r := query(t, addr, "sub.blog.dyndns.example.com.", dns.TypeA)
+	if r.Rcode != dns.RcodeNameError {
+		t.Fatalf("Expected NXDOMAIN but got %s", dns.RcodeToString[r.Rcode])
+	}
+
+	if _, ok := r.Ns[0].(*dns.SOA); !ok {
+		t.Fatalf("Expected soa in authority section but got %v", r.Ns)
+	}
+}
+
+func TestServeDNSToAnswerWildcardSubdomain(t *testing.T) {
+	addr, _ := startTestServer(t, true)
+
+	r := query(t, addr, "sub.blog.dyndns.example.com.", dns.TypeA)
+	if len(r.Answer) != 1 || r.Answer[0].Header().Name != "sub.blog.dyndns.example.com." {
+		t.Fatalf("Expected wildcard answer but got %v", r.Answer)
+	}
+}
+
+func TestServeDNSToAnswerApexRecords(t *testing.T) {
+	addr, _ := startTestServer(t, false)
+
+	r := query(t, addr, "dyndns.example.com.", dns.TypeNS)
+	if ns, ok := r.Answer[0].(*dns.NS); !ok || ns.Ns != "ns.example.com." {
+		t.Fatalf("Expected NS ns.example.com. but got %v", r.Answer)
+	}
+
+	r = query(t, addr, "dyndns.example.com.", dns.TypeSOA)
+	if _, ok := r.Answer[0].(*dns.SOA); !ok {
+		t.Fatalf("Expected SOA but got %v", r.Answer)
+	}
+}
+
+func TestServeDNSToRefuseForeignZones(t *testing.T) {
+	addr, _ := startTestServer(t, false)
+
+	r := query(t, addr, "example.org.", dns.TypeA)
+	if r.Rcode != dns.RcodeRefused {
+		t.Fatalf("Expected REFUSED but got %s", dns.RcodeToString[r.Rcode])
+	}
+}
+
+func TestServeDNSToAnswerAddedRecords(t *testing.T) {
+	addr, s := startTestServer(t, false)
+	s.AddRecord("_acme-challenge.blog", `"one"`, "TXT", "dyndns.example.com", 60)
+	s.AddRecord("_acme-challenge.blog", `"two"`, "TXT", "dyndns.example.com", 60)
+
+	r := query(t, addr, "_acme-challenge.blog.dyndns.example.com.", dns.TypeTXT)
+	if r.Rcode != dns.RcodeSuccess || len(r.Answer) != 2 {
+		t.Fatalf("Expected two TXT records but got %v", r)
+	}
+
+	s.RemoveRecord("_acme-challenge.blog", `"one"`, "TXT", "dyndns.example.com")
+	r = query(t, addr, "_acme-challenge.blog.dyndns.example.com.", dns.TypeTXT)
+	if len(r.Answer) != 1 || r.Answer[0].(*dns.TXT).Txt[0] != "two" {
+		t.Fatalf("Expected TXT record two but got %v", r)
+	}
+
+	s.RemoveRecord("_acme-challenge.blog", `"two"`, "TXT", "dyndns.example.com")
+	r = query(t, addr, "_acme-challenge.blog.dyndns.example.com.", dns.TypeTXT)
+	if r.Rcode != dns.RcodeNameError {
+		t.Fatalf("Expected NXDOMAIN but got %v", r)
+	}
+}
+
+func TestServeDNSToAnswerHostRecords(t *testing.T) {
+	addr, s := startTestServer(t, false)
+	host := &model.Host{}
+	s.DB.First(host)
+	s.DB.Create(&model.Record{HostID: host.ID, Type: "MX", Value: "mail.example.com", Priority: 10, Ttl: 300})
+	s.DB.Create(&model.Record{HostID: host.ID, Type: "TXT", Value: `v=spf1 "mx" -all`, Ttl: 300})
+	s.DB.Create(&model.Record{HostID: host.ID, Type: "SRV", Name: "_sip._udp", Value: "blog.dyndns.example.com", Priority: 10, Weight: 5, Port: 5060, Ttl: 300})
+
+	r := query(t, addr, "blog.dyndns.example.com.", dns.TypeMX)
+	if mx, ok := r.Answer[0].(*dns.MX); len(r.Answer) != 1 || !ok || mx.Mx != "mail.example.com." || mx.Preference != 10 {
+		t.Fatalf("Expected MX 10 mail.example.com. but got %v", r.Answer)
+	}
+
+	r = query(t, addr, "blog.dyndns.example.com.", dns.TypeTXT)
+	if txt, ok := r.Answer[0].(*dns.TXT); len(r.Answer) != 1 || !ok || txt.Txt[0] != `v=spf1 \"mx\" -all` {
+		t.Fatalf("Expected TXT record but got %v", r.Answer)
+	}
+
+	r = query(t, addr, "blog.dyndns.example.com.", dns.TypeA)
+	if len(r.Answer) != 1 {
+		t.Fatalf("Expected the address next to the records but got %v", r.Answer)
+	}
+
+	r = query(t, addr, "_sip._udp.blog.dyndns.example.com.", dns.TypeSRV)
+	if srv, ok := r.Answer[0].(*dns.SRV); len(r.Answer) != 1 || !ok || srv.Port != 5060 || srv.Target != "blog.dyndns.example.com." {
+		t.Fatalf("Expected SRV record but got %v", r.Answer)
+	}
+
+	records, err := s.ListRecords("dyndns.example.com")
+	if err != nil || len(records) != 8 {
+		t.Fatalf("Expected soa, ns, a, aaaa, cname and 3 host records but got %v, %v", records, err)
+	}
+}
+
+func TestServeDNSToTruncateLargeUDPReplies(t *testing.T) {
+	addr, s := startTestServer(t, false)
+	host := &model.Host{}
+	s.DB.First(host)
+	for i := 0; i < 4; i++ {
+		s.DB.Create(&model.Record{HostID: host.ID, Type: "TXT", Value: fmt.Sprintf("%d%s", i, strings.Repeat("a", 250)), Ttl: 300})
+	}
+
+	r := query(t, addr, "blog.dyndns.example.com.", dns.TypeTXT)
+	if !r.Truncated || r.Len() > dns.MinMsgSize {
+		t.Fatalf("Expected reply truncated to 512 bytes but got %d bytes", r.Len())
+	}
+
+	m := new(dns.Msg)
+	m.SetQuestion("blog.dyndns.example.com.", dns.TypeTXT)
+	m.SetEdns0(4096, false)
+	r, err := dns.Exchange(m, addr)
+	if err != nil || r.Truncated || len(r.Answer) != 4 {
+		t.Fatalf("Expected all 4 records within the EDNS0 buffer size but got %v, %v", r, err)
+	}
+}
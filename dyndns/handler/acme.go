@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/acme"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	// certRenewalInterval is the interval the certificate is checked for renewal in.
+	certRenewalInterval = 12 * time.Hour
+	// certRenewBefore is how long before its expiry the certificate is renewed.
+	certRenewBefore = 30 * 24 * time.Hour
+	// defaultPropagationDelay is the time the challenge records get to reach all name servers.
+	defaultPropagationDelay = 10 * time.Second
+)
+
+// initACME creates the certificate manager, if certificate domains are configured.
+// The challenges are answered through the DNS backend, so it has to be set up before.
+func (h *Handler) initACME() (err error) {
+	domains := splitList(os.Getenv("DDNS_ACME_DOMAINS"))
+	if len(domains) == 0 {
+		return nil
+	}
+
+	manager := &acme.Manager{
+		Domains:          domains,
+		Zones:            h.Config.Domains,
+		Email:            os.Getenv("DDNS_ACME_EMAIL"),
+		CA:               os.Getenv("DDNS_ACME_CA"),
+		Dir:              "database/acme",
+		Backend:          h.DNS,
+		PropagationDelay: defaultPropagationDelay,
+		RenewBefore:      certRenewBefore,
+	}
+	if manager.CA == "" {
+		manager.CA = acme.LetsEncryptURL
+	}
+
+	if delay := os.Getenv("DDNS_ACME_PROPAGATION_DELAY"); delay != "" {
+		if manager.PropagationDelay, err = time.ParseDuration(delay); err != nil || manager.PropagationDelay < 0 {
+			return fmt.Errorf("environment variable DDNS_ACME_PROPAGATION_DELAY is invalid: %s", delay)
+		}
+	}
+
+	if err = manager.Load(); err != nil {
+		return fmt.Errorf("loading certificate: %w", err)
+	}
+
+	log.Info("TLS enabled for: ", domains)
+	h.ACME = manager
+
+	return nil
+}
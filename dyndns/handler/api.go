@@ -0,0 +1,762 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPerPage = 50
+	maxPerPage     = 500
+)
+
+var errInvalidRequest = errors.New("invalid request")
+
+// Page is a paginated list of items returned by the API.
+type Page struct {
+	Items   interface{} `json:"items"`
+	Page    int         `json:"page"`
+	PerPage int         `json:"per_page"`
+	Total   int64       `json:"total"`
+}
+
+type hostResponse struct {
+	ID             uint      `json:"id"`
+	Hostname       string    `json:"hostname"`
+	Domain         string    `json:"domain"`
+	Ipv4           string    `json:"ipv4"`
+	Ipv6           string    `json:"ipv6"`
+	Ttl            int       `json:"ttl"`
+	LastUpdate     time.Time `json:"last_update"`
+	Ipv4LastUpdate time.Time `json:"ipv4_last_update"`
+	Ipv6LastUpdate time.Time `json:"ipv6_last_update"`
+	UserName       string    `json:"username"`
+	Blocked        bool      `json:"blocked"`
+	UpdateInterval int       `json:"update_interval"`
+	LastSeen       time.Time `json:"last_seen"`
+	Stale          bool      `json:"stale"`
+	OwnerID        uint      `json:"owner_id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// hostRequest is the body of POST, PUT and PATCH requests on hosts.
+// Fields missing in a PATCH request are left untouched,
+// the password is only replaced if a new one is given.
+// The owner can't be set by tenants.
+type hostRequest struct {
+	Hostname *string `json:"hostname"`
+	Domain   *string `json:"domain"`
+	Ipv4     *string `json:"ipv4"`
+	Ipv6     *string `json:"ipv6"`
+	Ttl      *int    `json:"ttl"`
+	UserName *string `json:"username"`
+	Password *string `json:"password"`
+	Blocked  *bool   `json:"blocked"`
+	// UpdateInterval is the expected update interval in minutes.
+	UpdateInterval *int  `json:"update_interval"`
+	OwnerID        *uint `json:"owner_id"`
+}
+
+type cnameResponse struct {
+	ID        uint      `json:"id"`
+	Hostname  string    `json:"hostname"`
+	Domain    string    `json:"domain"`
+	TargetID  uint      `json:"target_id"`
+	Target    string    `json:"target"`
+	Ttl       int       `json:"ttl"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// cnameRequest is the body of POST, PUT and PATCH requests on cnames.
+// Fields missing in a PATCH request are left untouched.
+type cnameRequest struct {
+	Hostname *string `json:"hostname"`
+	TargetID *uint   `json:"target_id"`
+	Ttl      *int    `json:"ttl"`
+}
+
+type logResponse struct {
+	ID        uint      `json:"id"`
+	HostID    uint      `json:"host_id"`
+	Host      string    `json:"host"`
+	Status    bool      `json:"status"`
+	Unchanged bool      `json:"unchanged"`
+	Message   string    `json:"message"`
+	SentIP    string    `json:"sent_ip"`
+	CallerIP  string    `json:"caller_ip"`
+	UserAgent string    `json:"user_agent"`
+	TimeStamp time.Time `json:"timestamp"`
+}
+
+func newHostResponse(host *model.Host) *hostResponse {
+	return &hostResponse{
+		ID:             host.ID,
+		Hostname:       host.Hostname,
+		Domain:         host.Domain,
+		Ipv4:           host.Ipv4,
+		Ipv6:           host.Ipv6,
+		Ttl:            host.Ttl,
+		LastUpdate:     host.LastUpdate,
+		Ipv4LastUpdate: host.Ipv4LastUpdate,
+		Ipv6LastUpdate: host.Ipv6LastUpdate,
+		UserName:       host.UserName,
+		Blocked:        host.Blocked,
+		UpdateInterval: host.UpdateInterval,
+		LastSeen:       host.LastSeen,
+		Stale:          host.Stale,
+		OwnerID:        host.OwnerID,
+		CreatedAt:      host.CreatedAt,
+		UpdatedAt:      host.UpdatedAt,
+	}
+}
+
+func newCNameResponse(cname *model.CName) *cnameResponse {
+	return &cnameResponse{
+		ID:        cname.ID,
+		Hostname:  cname.Hostname,
+		Domain:    cname.Target.Domain,
+		TargetID:  cname.TargetID,
+		Target:    cname.Target.Hostname + "." + cname.Target.Domain,
+		Ttl:       cname.Ttl,
+		CreatedAt: cname.CreatedAt,
+		UpdatedAt: cname.UpdatedAt,
+	}
+}
+
+func newLogResponse(log *model.Log) *logResponse {
+	return &logResponse{
+		ID:        log.ID,
+		HostID:    log.HostID,
+		Host:      log.Host.Hostname + "." + log.Host.Domain,
+		Status:    log.Status,
+		Unchanged: log.Unchanged,
+		Message:   log.Message,
+		SentIP:    log.SentIP,
+		CallerIP:  log.CallerIP,
+		UserAgent: log.UserAgent,
+		TimeStamp: log.TimeStamp,
+	}
+}
+
+// apiError maps err to a http status code and renders it as json error body.
+func apiError(c echo.Context, err error) error {
+	status := http.StatusInternalServerError
+
+	var validationErrors validator.ValidationErrors
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errHostnameExists):
+		status = http.StatusConflict
+	case errors.Is(err, errForbidden):
+		status = http.StatusForbidden
+	case errors.Is(err, errInvalidRequest), errors.As(err, &validationErrors):
+		status = http.StatusBadRequest
+	}
+
+	return c.JSON(status, &Error{err.Error()})
+}
+
+// paginate reads the "page" and "per_page" query parameters and applies them to query.
+// The total number of matching rows is counted before.
+func paginate(c echo.Context, query *gorm.DB) (*gorm.DB, *Page, error) {
+	p := &Page{Page: 1, PerPage: defaultPerPage}
+
+	var err error
+	if param := c.QueryParam("page"); param != "" {
+		if p.Page, err = strconv.Atoi(param); err != nil || p.Page < 1 {
+			return nil, nil, fmt.Errorf("page has to be a positive integer")
+		}
+	}
+
+	if param := c.QueryParam("per_page"); param != "" {
+		if p.PerPage, err = strconv.Atoi(param); err != nil || p.PerPage < 1 || p.PerPage > maxPerPage {
+			return nil, nil, fmt.Errorf("per_page has to be an integer between 1 and %d", maxPerPage)
+		}
+	}
+
+	if err = query.Count(&p.Total).Error; err != nil {
+		return nil, nil, err
+	}
+
+	return query.Offset((p.Page - 1) * p.PerPage).Limit(p.PerPage), p, nil
+}
+
+// APIListHosts returns a page of hosts, optionally filtered by "domain", "hostname" and "ip" (IPv4 or IPv6).
+func (h *Handler) APIListHosts(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	query := h.DB.Model(&model.Host{}).Scopes(tenantHosts(c)).Where(&model.Host{
+		Hostname: c.QueryParam("hostname"),
+		Domain:   c.QueryParam("domain"),
+	})
+	if ip := c.QueryParam("ip"); ip != "" {
+		query = query.Where("ipv4 = ? OR ipv6 = ?", ip, ip)
+	}
+
+	query, page, err := paginate(c, query)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	hosts := new([]model.Host)
+	if err = query.Order("id").Find(hosts).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	items := []*hostResponse{}
+	for i := range *hosts {
+		items = append(items, newHostResponse(&(*hosts)[i]))
+	}
+	page.Items = items
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// APIGetHost returns a single host by "id".
+func (h *Handler) APIGetHost(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	host, err := h.apiFindHost(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, newHostResponse(host))
+}
+
+// APICreateHost creates a host and its DNS entry.
+func (h *Handler) APICreateHost(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	req := &hostRequest{}
+	if err = c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	if err = h.checkOwner(c, req.OwnerID); err != nil {
+		return apiError(c, err)
+	}
+
+	host := &model.Host{}
+	if err = req.apply(host, true); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = c.Validate(host); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = applyTenant(c, host); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.createHost(host); err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "create host", host.Hostname+"."+host.Domain)
+
+	return c.JSON(http.StatusCreated, newHostResponse(host))
+}
+
+// APIReplaceHost replaces all fields of a host by "id" (PUT).
+func (h *Handler) APIReplaceHost(c echo.Context) (err error) {
+	return h.apiUpdateHost(c, true)
+}
+
+// APIPatchHost updates the given fields of a host by "id" (PATCH).
+func (h *Handler) APIPatchHost(c echo.Context) (err error) {
+	return h.apiUpdateHost(c, false)
+}
+
+func (h *Handler) apiUpdateHost(c echo.Context, replace bool) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	host, err := h.apiFindHost(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	req := &hostRequest{}
+	if err = c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	if err = h.checkOwner(c, req.OwnerID); err != nil {
+		return apiError(c, err)
+	}
+
+	oldIpv4, oldIpv6, oldTtl := host.Ipv4, host.Ipv6, host.Ttl
+	if err = req.apply(host, replace); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = c.Validate(host); err != nil {
+		return apiError(c, err)
+	}
+
+	updateRecord := host.Ipv4 != oldIpv4 || host.Ipv6 != oldIpv6 || host.Ttl != oldTtl
+	if updateRecord {
+		host.LastUpdate = time.Now()
+	}
+
+	if err = h.saveHost(host, updateRecord); err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "update host", host.Hostname+"."+host.Domain)
+
+	return c.JSON(http.StatusOK, newHostResponse(host))
+}
+
+// APIDeleteHost deletes a host by "id" together with its cnames, logs and DNS entry.
+func (h *Handler) APIDeleteHost(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	host, err := h.apiFindHost(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.deleteHost(host); err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "delete host", host.Hostname+"."+host.Domain)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// apiFindHost fetches the host referenced by the "id" path parameter.
+func (h *Handler) apiFindHost(c echo.Context) (*model.Host, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidRequest, err)
+	}
+
+	host := &model.Host{}
+	if err = h.DB.Scopes(tenantHosts(c)).First(host, id).Error; err != nil {
+		return nil, err
+	}
+
+	return host, nil
+}
+
+// apply copies the request fields to host.
+// If replace is set all mandatory fields have to be present.
+func (r *hostRequest) apply(host *model.Host, replace bool) error {
+	if replace && (r.Hostname == nil || r.Domain == nil || r.Ttl == nil || r.UserName == nil) {
+		return fmt.Errorf("%w: hostname, domain, ttl and username are required", errInvalidRequest)
+	}
+
+	if host.ID == 0 && r.Password == nil {
+		return fmt.Errorf("%w: password is required", errInvalidRequest)
+	}
+
+	if host.ID != 0 {
+		if (r.Hostname != nil && *r.Hostname != host.Hostname) || (r.Domain != nil && *r.Domain != host.Domain) {
+			return fmt.Errorf("%w: hostname and domain can not be changed", errInvalidRequest)
+		}
+	}
+
+	if r.Hostname != nil {
+		host.Hostname = *r.Hostname
+	}
+	if r.Domain != nil {
+		host.Domain = *r.Domain
+	}
+	now := time.Now()
+	if r.Ipv4 != nil {
+		host.SetIPv4(*r.Ipv4, now)
+	} else if replace {
+		host.SetIPv4("", now)
+	}
+	if r.Ipv6 != nil {
+		host.SetIPv6(*r.Ipv6, now)
+	} else if replace {
+		host.SetIPv6("", now)
+	}
+	if r.Ttl != nil {
+		host.Ttl = *r.Ttl
+	}
+	if r.UserName != nil {
+		host.UserName = *r.UserName
+	}
+	if r.Password != nil && *r.Password != "" {
+		host.Password = *r.Password
+	}
+	if r.Blocked != nil {
+		host.Blocked = *r.Blocked
+	} else if replace {
+		host.Blocked = false
+	}
+	interval := host.UpdateInterval
+	if r.UpdateInterval != nil {
+		interval = *r.UpdateInterval
+	} else if replace {
+		interval = 0
+	}
+	if interval != host.UpdateInterval {
+		host.UpdateInterval = interval
+		host.Stale = false
+	}
+	if r.OwnerID != nil {
+		host.OwnerID = *r.OwnerID
+	}
+
+	return nil
+}
+
+// APIListCNames returns a page of cnames, optionally filtered by "hostname", "domain" and "target_id".
+func (h *Handler) APIListCNames(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	query := h.DB.Model(&model.CName{}).Scopes(h.tenantCNames(c)).Where(&model.CName{Hostname: c.QueryParam("hostname")})
+	if param := c.QueryParam("target_id"); param != "" {
+		targetID, err := strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+		}
+		query = query.Where(&model.CName{TargetID: uint(targetID)})
+	}
+	if domain := c.QueryParam("domain"); domain != "" {
+		query = query.Where("target_id IN (?)", h.tenantHostIDs(c).Where(&model.Host{Domain: domain}))
+	}
+
+	query, page, err := paginate(c, query)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	cnames := new([]model.CName)
+	if err = query.Preload("Target").Order("id").Find(cnames).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	items := []*cnameResponse{}
+	for i := range *cnames {
+		items = append(items, newCNameResponse(&(*cnames)[i]))
+	}
+	page.Items = items
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// APIGetCName returns a single cname by "id".
+func (h *Handler) APIGetCName(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	cname, err := h.apiFindCName(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, newCNameResponse(cname))
+}
+
+// APICreateCName creates a cname and its DNS entry.
+func (h *Handler) APICreateCName(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	req := &cnameRequest{}
+	if err = c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	cname := &model.CName{}
+	if err = h.applyCNameRequest(c, req, cname, true); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = c.Validate(cname); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.createCName(cname); err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "create cname", cname.Hostname+"."+cname.Target.Domain)
+
+	return c.JSON(http.StatusCreated, newCNameResponse(cname))
+}
+
+// APIReplaceCName replaces all fields of a cname by "id" (PUT).
+func (h *Handler) APIReplaceCName(c echo.Context) (err error) {
+	return h.apiUpdateCName(c, true)
+}
+
+// APIPatchCName updates the given fields of a cname by "id" (PATCH).
+func (h *Handler) APIPatchCName(c echo.Context) (err error) {
+	return h.apiUpdateCName(c, false)
+}
+
+func (h *Handler) apiUpdateCName(c echo.Context, replace bool) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	cname, err := h.apiFindCName(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	req := &cnameRequest{}
+	if err = c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	if err = h.applyCNameRequest(c, req, cname, replace); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = c.Validate(cname); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.saveCName(cname); err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "update cname", cname.Hostname+"."+cname.Target.Domain)
+
+	return c.JSON(http.StatusOK, newCNameResponse(cname))
+}
+
+// APIDeleteCName deletes a cname by "id" together with its DNS entry.
+func (h *Handler) APIDeleteCName(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	cname, err := h.apiFindCName(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.deleteCName(cname); err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "delete cname", cname.Hostname+"."+cname.Target.Domain)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// apiFindCName fetches the cname referenced by the "id" path parameter.
+func (h *Handler) apiFindCName(c echo.Context) (*model.CName, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidRequest, err)
+	}
+
+	cname := &model.CName{}
+	if err = h.DB.Scopes(h.tenantCNames(c)).Preload("Target").First(cname, id).Error; err != nil {
+		return nil, err
+	}
+
+	return cname, nil
+}
+
+// applyCNameRequest copies the request fields to cname and resolves its target.
+// If replace is set all fields have to be present.
+func (h *Handler) applyCNameRequest(c echo.Context, r *cnameRequest, cname *model.CName, replace bool) error {
+	if replace && (r.Hostname == nil || r.TargetID == nil || r.Ttl == nil) {
+		return fmt.Errorf("%w: hostname, target_id and ttl are required", errInvalidRequest)
+	}
+
+	if cname.ID != 0 && r.Hostname != nil && *r.Hostname != cname.Hostname {
+		return fmt.Errorf("%w: hostname can not be changed", errInvalidRequest)
+	}
+
+	if r.Hostname != nil {
+		cname.Hostname = *r.Hostname
+	}
+	if r.Ttl != nil {
+		cname.Ttl = *r.Ttl
+	}
+	if r.TargetID != nil && *r.TargetID != cname.TargetID {
+		target := &model.Host{}
+		if err := h.DB.Scopes(tenantHosts(c)).First(target, *r.TargetID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: target %d not found", errInvalidRequest, *r.TargetID)
+			}
+
+			return err
+		}
+
+		// the cname lives in the zone of its target
+		if cname.ID != 0 && target.Domain != cname.Target.Domain {
+			return fmt.Errorf("%w: target has to be in domain %s", errInvalidRequest, cname.Target.Domain)
+		}
+
+		cname.Target = *target
+		cname.TargetID = target.ID
+	}
+
+	return nil
+}
+
+// APIListLogs returns a page of log entries, newest first,
+// optionally filtered by "host_id", "status", "unchanged" and the time range "since" and "until" (RFC 3339).
+func (h *Handler) APIListLogs(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	query := h.DB.Model(&model.Log{}).Scopes(h.tenantLogs(c))
+	if param := c.QueryParam("host_id"); param != "" {
+		hostID, err := strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+		}
+		query = query.Where(&model.Log{HostID: uint(hostID)})
+	}
+	if param := c.QueryParam("status"); param != "" {
+		status, err := strconv.ParseBool(param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+		}
+		query = query.Where("status = ?", status)
+	}
+	if param := c.QueryParam("unchanged"); param != "" {
+		unchanged, err := strconv.ParseBool(param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+		}
+		query = query.Where("unchanged = ?", unchanged)
+	}
+	if param := c.QueryParam("since"); param != "" {
+		since, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+		}
+		query = query.Where("created_at >= ?", since)
+	}
+	if param := c.QueryParam("until"); param != "" {
+		until, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+		}
+		query = query.Where("created_at < ?", until)
+	}
+
+	query, page, err := paginate(c, query)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	logs := new([]model.Log)
+	if err = query.Preload("Host").Order("created_at desc").Find(logs).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	items := []*logResponse{}
+	for i := range *logs {
+		items = append(items, newLogResponse(&(*logs)[i]))
+	}
+	page.Items = items
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// APIGetLog returns a single log entry by "id".
+func (h *Handler) APIGetLog(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	log := &model.Log{}
+	if err = h.DB.Scopes(h.tenantLogs(c)).Preload("Host").First(log, id).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, newLogResponse(log))
+}
+
+// APIDeleteLog deletes a single log entry by "id".
+func (h *Handler) APIDeleteLog(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	log := &model.Log{}
+	if err = h.DB.Scopes(h.tenantLogs(c)).First(log, id).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.DB.Unscoped().Delete(log).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "delete log", strconv.Itoa(id))
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// APIListRecords returns the records the DNS backend holds for the zone "zone".
+func (h *Handler) APIListRecords(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	zone := c.Param("zone")
+	if !h.isDomain(zone) || (tenant(c) != nil && !tenant(c).HasDomain(zone)) {
+		return c.JSON(http.StatusNotFound, &Error{fmt.Sprintf("zone %s is not handled by this server", zone)})
+	}
+
+	records, err := h.DNS.ListRecords(zone)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, &Error{err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, records)
+}
+
+// isDomain tells if domain is one of the configured dyndns domains.
+func (h *Handler) isDomain(domain string) bool {
+	for _, d := range h.Config.Domains {
+		if d == domain {
+			return true
+		}
+	}
+
+	return false
+}
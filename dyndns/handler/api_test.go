@@ -0,0 +1,230 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/migrate"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/nswrapper"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeBackend records all DNS changes instead of sending them to a name server.
+type fakeBackend struct {
+	updates []string
+	deletes []string
+}
+
+func (f *fakeBackend) UpdateRecord(hostname string, target string, addrType string, zone string, ttl int, enableWildcard bool) error {
+	f.updates = append(f.updates, hostname+"."+zone+" "+addrType+" "+target)
+	return nil
+}
+
+func (f *fakeBackend) DeleteRecord(hostname string, zone string, enableWildcard bool) error {
+	f.deletes = append(f.deletes, hostname+"."+zone)
+	return nil
+}
+
+func (f *fakeBackend) DeleteRecordType(hostname string, addrType string, zone string, enableWildcard bool) error {
+	f.deletes = append(f.deletes, hostname+"."+zone+" "+addrType)
+	return nil
+}
+
+func (f *fakeBackend) UpdateRecordSet(hostname string, targets []string, addrType string, zone string, ttl int) error {
+	f.updates = append(f.updates, "set "+hostname+"."+zone+" "+addrType+" "+strings.Join(targets, ", "))
+	return nil
+}
+
+func (f *fakeBackend) AddRecord(hostname string, target string, addrType string, zone string, ttl int) error {
+	f.updates = append(f.updates, "add "+hostname+"."+zone+" "+addrType+" "+target)
+	return nil
+}
+
+func (f *fakeBackend) RemoveRecord(hostname string, target string, addrType string, zone string) error {
+	f.deletes = append(f.deletes, "remove "+hostname+"."+zone+" "+addrType+" "+target)
+	return nil
+}
+
+func (f *fakeBackend) ListRecords(zone string) ([]nswrapper.Record, error) {
+	return []nswrapper.Record{}, nil
+}
+
+// newTestHandler creates a handler with an in-memory database and a fake DNS backend.
+func newTestHandler(t *testing.T) (*Handler, *fakeBackend) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err = migrate.Up(db); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	backend := &fakeBackend{}
+	h := &Handler{
+		DB:     db,
+		DNS:    backend,
+		Config: Envs{Domains: []string{"dyndns.example.com"}},
+	}
+
+	return h, backend
+}
+
+func newTestEcho() *echo.Echo {
+	e := echo.New()
+	e.Validator = &CustomValidator{Validator: validator.New()}
+
+	return e
+}
+
+// serve executes a single request against handler and returns the recorded response.
+func serve(e *echo.Echo, handler echo.HandlerFunc, method string, path string, body string, params ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+
+	c := e.NewContext(req, rec)
+	setPrincipal(c, &Principal{Name: "admin", Role: model.RoleOwner})
+	names, values := []string{}, []string{}
+	for i := 0; i+1 < len(params); i += 2 {
+		names = append(names, params[i])
+		values = append(values, params[i+1])
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+
+	handler(c)
+
+	return rec
+}
+
+const testHostBody = `{"hostname":"blog","domain":"dyndns.example.com","ipv4":"1.2.3.4","ttl":60,"username":"bloguser","password":"blogpassword"}`
+
+func TestAPICreateHostToCreateHostAndRecord(t *testing.T) {
+	h, backend := newTestHandler(t)
+	e := newTestEcho()
+
+	rec := serve(e, h.APICreateHost, http.MethodPost, "/api/v1/hosts", testHostBody)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if strings.Contains(rec.Body.String(), "blogpassword") {
+		t.Fatalf("Expected password not to be returned but got %s", rec.Body.String())
+	}
+
+	if len(backend.updates) != 1 || backend.updates[0] != "blog.dyndns.example.com A 1.2.3.4" {
+		t.Fatalf("Expected A record update but got %v", backend.updates)
+	}
+
+	rec = serve(e, h.APICreateHost, http.MethodPost, "/api/v1/hosts", testHostBody)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Expected status 409 but got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAPICreateHostToReturnJSONErrorOnInvalidHost(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	rec := serve(newTestEcho(), h.APICreateHost, http.MethodPost, "/api/v1/hosts", `{"hostname":"blog"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 but got %d", rec.Code)
+	}
+
+	body := &Error{}
+	if err := json.Unmarshal(rec.Body.Bytes(), body); err != nil || body.Message == "" {
+		t.Fatalf("Expected json error body but got %s", rec.Body.String())
+	}
+}
+
+func TestAPIPatchHostToUpdateOnlyGivenFields(t *testing.T) {
+	h, backend := newTestHandler(t)
+	e := newTestEcho()
+	serve(e, h.APICreateHost, http.MethodPost, "/api/v1/hosts", testHostBody)
+
+	rec := serve(e, h.APIPatchHost, http.MethodPatch, "/api/v1/hosts/1", `{"ipv4":"5.6.7.8"}`, "id", "1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	host := &model.Host{}
+	h.DB.First(host, 1)
+	if host.Ipv4 != "5.6.7.8" || host.Ttl != 60 || host.UserName != "bloguser" {
+		t.Fatalf("Expected only the ip to change but got %+v", host)
+	}
+
+	if backend.updates[len(backend.updates)-1] != "blog.dyndns.example.com A 5.6.7.8" {
+		t.Fatalf("Expected A record update but got %v", backend.updates)
+	}
+
+	rec = serve(e, h.APIPatchHost, http.MethodPatch, "/api/v1/hosts/1", `{"hostname":"other"}`, "id", "1")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 but got %d", rec.Code)
+	}
+}
+
+func TestAPIDeleteHostToReturnNotFoundForUnknownHost(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	rec := serve(newTestEcho(), h.APIDeleteHost, http.MethodDelete, "/api/v1/hosts/42", "", "id", "42")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 but got %d", rec.Code)
+	}
+}
+
+func TestAPIListHostsToPaginateAndFilter(t *testing.T) {
+	h, _ := newTestHandler(t)
+	for _, name := range []string{"a", "b", "c"} {
+		h.DB.Create(&model.Host{Hostname: name, Domain: "dyndns.example.com", Ttl: 60, UserName: name + "user", Password: "password"})
+	}
+	h.DB.Create(&model.Host{Hostname: "d", Domain: "dyndns.example.org", Ttl: 60, UserName: "duser", Password: "password"})
+
+	rec := serve(newTestEcho(), h.APIListHosts, http.MethodGet, "/api/v1/hosts?domain=dyndns.example.com&page=2&per_page=2", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	page := &struct {
+		Items []hostResponse `json:"items"`
+		Total int64          `json:"total"`
+	}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), page); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	if page.Total != 3 || len(page.Items) != 1 || page.Items[0].Hostname != "c" {
+		t.Fatalf("Expected second page with host c of 3 hosts but got %+v", page)
+	}
+}
+
+func TestAPICreateCNameToCreateRecord(t *testing.T) {
+	h, backend := newTestHandler(t)
+	e := newTestEcho()
+	serve(e, h.APICreateHost, http.MethodPost, "/api/v1/hosts", testHostBody)
+
+	rec := serve(e, h.APICreateCName, http.MethodPost, "/api/v1/cnames", `{"hostname":"www","target_id":1,"ttl":60}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if backend.updates[len(backend.updates)-1] != "www.dyndns.example.com CNAME blog.dyndns.example.com" {
+		t.Fatalf("Expected CNAME record update but got %v", backend.updates)
+	}
+
+	rec = serve(e, h.APICreateCName, http.MethodPost, "/api/v1/cnames", `{"hostname":"ftp","target_id":7,"ttl":60}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 but got %d", rec.Code)
+	}
+}
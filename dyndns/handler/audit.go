@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/echo/v4"
+	l "github.com/labstack/gommon/log"
+)
+
+type auditResponse struct {
+	ID        uint      `json:"id"`
+	UserName  string    `json:"username"`
+	Action    string    `json:"action"`
+	Object    string    `json:"object"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// audit records an admin action on object, attributed to the principal of the request.
+// Failures are logged only, they never fail the action itself.
+func (h *Handler) audit(c echo.Context, action string, object string) {
+	entry := &model.Audit{Action: action, Object: object}
+	if principal := GetPrincipal(c); principal != nil {
+		entry.UserName = principal.Name
+	}
+
+	if err := h.DB.Create(entry).Error; err != nil {
+		l.Error("Error: ", err)
+	}
+}
+
+// ShowAudit fetches the latest admin actions and renders them to the website.
+func (h *Handler) ShowAudit(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	audits := new([]model.Audit)
+	if err = h.DB.Scopes(tenantAudits(c)).Order("created_at desc").Limit(100).Find(audits).Error; err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	return c.Render(http.StatusOK, "listaudit", echo.Map{
+		"audits": audits,
+		"title":  h.Title,
+	})
+}
+
+// APIListAudit returns a page of admin actions, newest first, optionally filtered by "username".
+func (h *Handler) APIListAudit(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	query := h.DB.Model(&model.Audit{}).Scopes(tenantAudits(c)).Where(&model.Audit{UserName: c.QueryParam("username")})
+
+	query, page, err := paginate(c, query)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	audits := new([]model.Audit)
+	if err = query.Order("created_at desc").Find(audits).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	items := []*auditResponse{}
+	for _, a := range *audits {
+		items = append(items, &auditResponse{
+			ID:        a.ID,
+			UserName:  a.UserName,
+			Action:    a.Action,
+			Object:    a.Object,
+			CreatedAt: a.CreatedAt,
+		})
+	}
+	page.Items = items
+
+	return c.JSON(http.StatusOK, page)
+}
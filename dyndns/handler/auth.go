@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	// principalContextKey is the echo context key of the authenticated principal of a request.
+	principalContextKey = "principal"
+	// adminAuthContextKey is the echo context key of AdminAuthEnabled of a request.
+	adminAuthContextKey = "adminAuth"
+)
+
+// Principal is the authenticated admin of a single request.
+// It is stored in the echo context by the authentication middlewares,
+// so authorization never leaks between concurrent requests.
+type Principal struct {
+	Name string
+	// Role is the admin role of a login, it is empty for api tokens.
+	Role string
+	// Token is set if the request is authenticated by an api token.
+	Token *model.Token
+	// User is set if the request is authenticated by an admin user of the database.
+	User *model.User
+}
+
+// Tenant returns the tenant user of the principal or nil, if the principal is not restricted to a tenant.
+func (p *Principal) Tenant() *model.User {
+	if p.User == nil || !p.User.Tenant {
+		return nil
+	}
+
+	return p.User
+}
+
+// HasScope tells if the principal is allowed to access routes requiring scope.
+// Api tokens are limited to their granted scopes, logins to the scopes of their role.
+func (p *Principal) HasScope(scope string) bool {
+	if p.Token != nil {
+		return p.Token.HasScope(scope)
+	}
+
+	return model.RoleHasScope(p.Role, scope)
+}
+
+// GetPrincipal returns the authenticated principal of the request or nil.
+func GetPrincipal(c echo.Context) *Principal {
+	principal, _ := c.Get(principalContextKey).(*Principal)
+	return principal
+}
+
+func setPrincipal(c echo.Context, principal *Principal) {
+	c.Set(principalContextKey, principal)
+}
+
+// AdminAuthEnabled tells if admins have to log in,
+// which is the case as soon as DDNS_ADMIN_LOGIN or the OIDC login is set or an admin user exists.
+func (h *Handler) AdminAuthEnabled() bool {
+	if h.Config.AdminLogin != "" || h.OIDCEnabled() {
+		return true
+	}
+
+	var users int64
+	if err := h.DB.Model(&model.User{}).Count(&users).Error; err != nil {
+		log.Error("Error: ", err)
+		return true
+	}
+
+	return users > 0
+}
+
+// adminAuthEnabled is AdminAuthEnabled computed once per request.
+func (h *Handler) adminAuthEnabled(c echo.Context) bool {
+	if enabled, ok := c.Get(adminAuthContextKey).(bool); ok {
+		return enabled
+	}
+
+	enabled := h.AdminAuthEnabled()
+	c.Set(adminAuthContextKey, enabled)
+
+	return enabled
+}
+
+// SkipAdminAuth skips the basic auth middleware for requests authenticated by api token or session
+// and if the admin login is disabled.
+func (h *Handler) SkipAdminAuth(c echo.Context) bool {
+	return GetPrincipal(c) != nil || HasBearerToken(c) || !h.adminAuthEnabled(c)
+}
+
+// NoAuth authenticates every request as anonymous owner, if the admin login is disabled,
+// e.g. behind an auth proxy.
+// Requests already authenticated keep their principal.
+func (h *Handler) NoAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if GetPrincipal(c) == nil && !h.adminAuthEnabled(c) {
+			setPrincipal(c, &Principal{Name: "anonymous", Role: model.RoleOwner})
+		}
+
+		return next(c)
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// newAuthTestEcho protects the host list by the middleware chain of the api group in main.go.
+func newAuthTestEcho(t *testing.T) *echo.Echo {
+	h, _ := newTestHandler(t)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	h.Config.AdminLogin = "admin:" + string(hash)
+
+	e := newTestEcho()
+	g := e.Group("/api/v1", h.TokenAuth, h.SessionAuth, middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Skipper:   h.SkipAdminAuth,
+		Validator: h.AuthenticateAdmin,
+	}), h.NoAuth)
+	g.GET("/hosts", h.APIListHosts, h.RequireScope(model.ScopeReadOnly, model.ScopeHostsWrite))
+
+	return e
+}
+
+func adminRequest(e *echo.Echo, username string, password string) int {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/hosts", nil)
+	req.SetBasicAuth(username, password)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	return rec.Code
+}
+
+func TestAuthenticateAdminToRejectWrongPassword(t *testing.T) {
+	e := newAuthTestEcho(t)
+
+	if code := adminRequest(e, "admin", "secret"); code != http.StatusOK {
+		t.Fatalf("Expected status 200 but got %d", code)
+	}
+
+	// a preceding successful login must not authorize later requests
+	if code := adminRequest(e, "admin", "wrong"); code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 but got %d", code)
+	}
+}
+
+// TestAuthenticateAdminToIsolateParallelRequests runs successful and failed logins in parallel.
+// Run it with -race to detect shared authorization state.
+func TestAuthenticateAdminToIsolateParallelRequests(t *testing.T) {
+	e := newAuthTestEcho(t)
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 100)
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if code := adminRequest(e, "admin", "secret"); code != http.StatusOK {
+				errs <- "valid login got status " + http.StatusText(code)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if code := adminRequest(e, "admin", "wrong"); code != http.StatusUnauthorized {
+				errs <- "failed login got status " + http.StatusText(code)
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestHandlerToRejectRequestsWithoutPrincipal(t *testing.T) {
+	h, _ := newTestHandler(t)
+	e := newTestEcho()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/hosts", nil)
+	rec := httptest.NewRecorder()
+	h.APIListHosts(e.NewContext(req, rec))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 but got %d", rec.Code)
+	}
+}
@@ -0,0 +1,157 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// challengeTtl is the ttl of the challenge TXT records of hosts.
+	challengeTtl = 60
+	// challengePrefix is the label of the challenge TXT records below the hosts.
+	challengePrefix = "_acme-challenge."
+	// maxChallenges is the number of TXT records kept per host by the acme-dns endpoint,
+	// so a certificate for a host and its wildcard can be validated together.
+	maxChallenges = 2
+)
+
+// challengeValue matches the base64url encoded SHA-256 digest of a DNS-01 key authorization.
+var challengeValue = regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)
+
+// httpreqRequest is the body sent by the lego httpreq provider,
+// with fqdn and value by default or domain and keyAuth in raw mode.
+type httpreqRequest struct {
+	FQDN    string `json:"fqdn"`
+	Value   string `json:"value"`
+	Domain  string `json:"domain"`
+	KeyAuth string `json:"keyAuth"`
+}
+
+// acmeDNSRequest is the body of an acme-dns update, subdomain is the name of the host.
+type acmeDNSRequest struct {
+	Subdomain string `json:"subdomain"`
+	Txt       string `json:"txt"`
+}
+
+// PresentChallenge adds the challenge TXT record of a host for the lego httpreq provider.
+// The host is authenticated with its update credentials.
+func (h *Handler) PresentChallenge(c echo.Context) error {
+	host, value, status, err := bindHTTPReq(c)
+	if err != nil {
+		return c.JSON(status, &Error{err.Error()})
+	}
+
+	if err = h.DNS.AddRecord(challengePrefix+host.Hostname, `"`+value+`"`, "TXT", host.Domain, challengeTtl); err != nil {
+		return c.JSON(http.StatusBadGateway, &Error{err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, &Error{"OK"})
+}
+
+// CleanupChallenge removes the challenge TXT record of a host for the lego httpreq provider.
+func (h *Handler) CleanupChallenge(c echo.Context) error {
+	host, value, status, err := bindHTTPReq(c)
+	if err != nil {
+		return c.JSON(status, &Error{err.Error()})
+	}
+
+	if err = h.DNS.RemoveRecord(challengePrefix+host.Hostname, `"`+value+`"`, "TXT", host.Domain); err != nil {
+		return c.JSON(http.StatusBadGateway, &Error{err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, &Error{"OK"})
+}
+
+// UpdateChallenge sets the challenge TXT record of a host like the acme-dns /update endpoint.
+// The update credentials of the host are sent as X-Api-User and X-Api-Key headers.
+// Only the latest two values are kept, older ones are removed.
+func (h *Handler) UpdateChallenge(c echo.Context) error {
+	if ok, _ := h.AuthenticateUpdate(c.Request().Header.Get("X-Api-User"), c.Request().Header.Get("X-Api-Key"), c); !ok {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "forbidden"})
+	}
+
+	req := &acmeDNSRequest{}
+	if err := c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "malformed_json_payload"})
+	}
+
+	host := findChallengeHost(c, strings.TrimPrefix(strings.ToLower(req.Subdomain), challengePrefix))
+	if host == nil {
+		return c.JSON(http.StatusUnauthorized, echo.Map{"error": "forbidden"})
+	}
+
+	if !challengeValue.MatchString(req.Txt) {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "bad_txt"})
+	}
+
+	h.challengeMu.Lock()
+	defer h.challengeMu.Unlock()
+
+	if err := h.DNS.AddRecord(challengePrefix+host.Hostname, `"`+req.Txt+`"`, "TXT", host.Domain, challengeTtl); err != nil {
+		return c.JSON(http.StatusBadGateway, echo.Map{"error": "dns_update_failed"})
+	}
+
+	if h.challenges == nil {
+		h.challenges = map[uint][]string{}
+	}
+	values := append(h.challenges[host.ID], req.Txt)
+	for len(values) > maxChallenges {
+		if err := h.DNS.RemoveRecord(challengePrefix+host.Hostname, `"`+values[0]+`"`, "TXT", host.Domain); err != nil {
+			return c.JSON(http.StatusBadGateway, echo.Map{"error": "dns_update_failed"})
+		}
+		values = values[1:]
+	}
+	h.challenges[host.ID] = values
+
+	return c.JSON(http.StatusOK, echo.Map{"txt": req.Txt})
+}
+
+// bindHTTPReq reads a httpreq body and returns the authenticated host and the TXT value of the challenge,
+// or the status and error to answer with.
+func bindHTTPReq(c echo.Context) (*model.Host, string, int, error) {
+	req := &httpreqRequest{}
+	if err := c.Bind(req); err != nil {
+		return nil, "", http.StatusBadRequest, err
+	}
+
+	name, value := strings.ToLower(strings.TrimSuffix(req.FQDN, ".")), req.Value
+	if req.KeyAuth != "" {
+		digest := sha256.Sum256([]byte(req.KeyAuth))
+		name = challengePrefix + strings.ToLower(strings.TrimPrefix(strings.TrimSuffix(req.Domain, "."), "*."))
+		value = base64.RawURLEncoding.EncodeToString(digest[:])
+	}
+
+	if !strings.HasPrefix(name, challengePrefix) {
+		return nil, "", http.StatusBadRequest, fmt.Errorf("fqdn has to start with %s", challengePrefix)
+	}
+
+	if !challengeValue.MatchString(value) {
+		return nil, "", http.StatusBadRequest, fmt.Errorf("invalid challenge value")
+	}
+
+	host := findChallengeHost(c, strings.TrimPrefix(name, challengePrefix))
+	if host == nil {
+		return nil, "", http.StatusForbidden, fmt.Errorf("the credentials don't belong to %s", name)
+	}
+
+	return host, value, http.StatusOK, nil
+}
+
+// findChallengeHost returns the authenticated host named fqdn.
+func findChallengeHost(c echo.Context, fqdn string) *model.Host {
+	hosts, _ := c.Get("updateHosts").([]model.Host)
+	for i := range hosts {
+		if strings.ToLower(hosts[i].Hostname+"."+hosts[i].Domain) == fqdn {
+			return &hosts[i]
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	testChallenge1 = "LHDhK3oGRvkiefQnx7OOczTY5Tic_xZ6HcMOc_gmtoM"
+	testChallenge2 = "N2xvYmFsLWNoYWxsZW5nZS12YWx1ZS1mb3ItdGVzdHM"
+	testChallenge3 = "dGhpcmQtY2hhbGxlbmdlLXZhbHVlLWZvci10ZXN0czE"
+)
+
+// challengeRequest authenticates username and calls handler with the json body.
+func challengeRequest(t *testing.T, h *Handler, handler echo.HandlerFunc, username string, password string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/acme", strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	c := newTestEcho().NewContext(req, rec)
+
+	if ok, _ := h.AuthenticateUpdate(username, password, c); !ok {
+		t.Fatalf("Expected credentials of %s to be accepted", username)
+	}
+
+	if err := handler(c); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	return rec
+}
+
+func TestPresentChallengeToAddTXTRecordOfOwnHost(t *testing.T) {
+	h, backend := newTestHandler(t)
+	h.DB.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ttl: 60, UserName: "bloguser", Password: "blogpassword"})
+	h.DB.Create(&model.Host{Hostname: "shop", Domain: "dyndns.example.com", Ttl: 60, UserName: "shopuser", Password: "shoppassword"})
+
+	rec := challengeRequest(t, h, h.PresentChallenge, "bloguser", "blogpassword", `{"fqdn":"_acme-challenge.blog.dyndns.example.com.","value":"`+testChallenge1+`"}`)
+	if rec.Code != http.StatusOK || backend.updates[0] != `add _acme-challenge.blog.dyndns.example.com TXT "`+testChallenge1+`"` {
+		t.Fatalf("Expected TXT record to be added but got %d %v", rec.Code, backend.updates)
+	}
+
+	rec = challengeRequest(t, h, h.CleanupChallenge, "bloguser", "blogpassword", `{"domain":"*.blog.dyndns.example.com","token":"token","keyAuth":"token.thumbprint"}`)
+	if rec.Code != http.StatusOK || backend.deletes[0] != `remove _acme-challenge.blog.dyndns.example.com TXT "61rBZ_4knHblO0MNoxFsXZ_eTFUHum0B6IVRbhvUn5I"` {
+		t.Fatalf("Expected TXT record of raw key authorization to be removed but got %d %v", rec.Code, backend.deletes)
+	}
+
+	rec = challengeRequest(t, h, h.PresentChallenge, "bloguser", "blogpassword", `{"fqdn":"_acme-challenge.shop.dyndns.example.com.","value":"`+testChallenge1+`"}`)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403 for a foreign host but got %d", rec.Code)
+	}
+
+	rec = challengeRequest(t, h, h.PresentChallenge, "bloguser", "blogpassword", `{"fqdn":"_acme-challenge.blog.dyndns.example.com.","value":"bad value"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 for an invalid value but got %d", rec.Code)
+	}
+}
+
+func TestUpdateChallengeToKeepLatestTwoValues(t *testing.T) {
+	h, backend := newTestHandler(t)
+	h.DB.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ttl: 60, UserName: "bloguser", Password: "blogpassword"})
+	e := newTestEcho()
+
+	for _, value := range []string{testChallenge1, testChallenge2, testChallenge3} {
+		req := httptest.NewRequest(http.MethodPost, "/acme/update", strings.NewReader(`{"subdomain":"blog.dyndns.example.com","txt":"`+value+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set("X-Api-User", "bloguser")
+		req.Header.Set("X-Api-Key", "blogpassword")
+		rec := httptest.NewRecorder()
+
+		h.UpdateChallenge(e.NewContext(req, rec))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), value) {
+			t.Fatalf("Expected status 200 but got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	if len(backend.updates) != 3 || len(backend.deletes) != 1 || backend.deletes[0] != `remove _acme-challenge.blog.dyndns.example.com TXT "`+testChallenge1+`"` {
+		t.Fatalf("Expected the oldest value to be removed but got %v and %v", backend.updates, backend.deletes)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/acme/update", strings.NewReader(`{"subdomain":"blog.dyndns.example.com","txt":"`+testChallenge1+`"}`))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set("X-Api-User", "bloguser")
+	req.Header.Set("X-Api-Key", "wrong")
+	rec := httptest.NewRecorder()
+	h.UpdateChallenge(e.NewContext(req, rec))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 but got %d", rec.Code)
+	}
+}
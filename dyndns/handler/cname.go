@@ -6,19 +6,17 @@ import (
 	"strconv"
 
 	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
-	"github.com/benjaminbear/docker-ddns-server/dyndns/nswrapper"
 	"github.com/labstack/echo/v4"
-	"gorm.io/gorm"
 )
 
 // ListCNames fetches all cnames from database and lists them on the website.
 func (h *Handler) ListCNames(c echo.Context) (err error) {
-	if !h.AuthAdmin {
+	if GetPrincipal(c) == nil {
 		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
 	}
 
 	cnames := new([]model.CName)
-	if err = h.DB.Preload("Target").Find(cnames).Error; err != nil {
+	if err = h.DB.Scopes(h.tenantCNames(c)).Preload("Target").Find(cnames).Error; err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
@@ -31,12 +29,12 @@ func (h *Handler) ListCNames(c echo.Context) (err error) {
 // AddCName just renders the "add cname" website.
 // Therefore all host entries from the database are being fetched.
 func (h *Handler) AddCName(c echo.Context) (err error) {
-	if !h.AuthAdmin {
+	if GetPrincipal(c) == nil {
 		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
 	}
 
 	hosts := new([]model.Host)
-	if err = h.DB.Find(hosts).Error; err != nil {
+	if err = h.DB.Scopes(tenantHosts(c)).Find(hosts).Error; err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
@@ -51,7 +49,7 @@ func (h *Handler) AddCName(c echo.Context) (err error) {
 // adds the cname entry to the database,
 // and adds the entry to the DNS server.
 func (h *Handler) CreateCName(c echo.Context) (err error) {
-	if !h.AuthAdmin {
+	if GetPrincipal(c) == nil {
 		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
 	}
 
@@ -60,8 +58,13 @@ func (h *Handler) CreateCName(c echo.Context) (err error) {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
+	hostID, err := strconv.Atoi(c.FormValue("target_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
 	host := &model.Host{}
-	if err = h.DB.First(host, c.FormValue("target_id")).Error; err != nil {
+	if err = h.DB.Scopes(tenantHosts(c)).First(host, hostID).Error; err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
@@ -71,17 +74,11 @@ func (h *Handler) CreateCName(c echo.Context) (err error) {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
-	if err = h.checkUniqueHostname(cname.Hostname, cname.Target.Domain); err != nil {
-		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
-	}
-
-	if err = h.DB.Create(cname).Error; err != nil {
+	if err = h.createCName(cname); err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
-	if err = nswrapper.UpdateRecord(cname.Hostname, fmt.Sprintf("%s.%s", cname.Target.Hostname, cname.Target.Domain), "CNAME", cname.Target.Domain, cname.Ttl, h.AllowWildcard); err != nil {
-		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
-	}
+	h.audit(c, "create cname", cname.Hostname+"."+cname.Target.Domain)
 
 	return c.JSON(http.StatusOK, cname)
 }
@@ -89,7 +86,7 @@ func (h *Handler) CreateCName(c echo.Context) (err error) {
 // DeleteCName fetches a cname entry from the database by "id"
 // and deletes the database and DNS server entry to it.
 func (h *Handler) DeleteCName(c echo.Context) (err error) {
-	if !h.AuthAdmin {
+	if GetPrincipal(c) == nil {
 		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
 	}
 
@@ -99,24 +96,52 @@ func (h *Handler) DeleteCName(c echo.Context) (err error) {
 	}
 
 	cname := &model.CName{}
-	if err = h.DB.Preload("Target").First(cname, id).Error; err != nil {
+	if err = h.DB.Scopes(h.tenantCNames(c)).Preload("Target").First(cname, id).Error; err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
-	err = h.DB.Transaction(func(tx *gorm.DB) error {
-		if err = tx.Unscoped().Delete(cname).Error; err != nil {
-			return c.JSON(http.StatusBadRequest, &Error{err.Error()})
-		}
-
-		return nil
-	})
-	if err != nil {
+	if err = h.deleteCName(cname); err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
-	if err = nswrapper.DeleteRecord(cname.Hostname, cname.Target.Domain, h.AllowWildcard); err != nil {
-		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
-	}
+	h.audit(c, "delete cname", cname.Hostname+"."+cname.Target.Domain)
 
 	return c.JSON(http.StatusOK, id)
 }
+
+// createCName adds a validated cname entry to the database
+// and adds the entry to the DNS server.
+func (h *Handler) createCName(cname *model.CName) (err error) {
+	if err = h.checkUniqueHostname(cname.Hostname, cname.Target.Domain); err != nil {
+		return err
+	}
+
+	if err = h.DB.Create(cname).Error; err != nil {
+		return err
+	}
+
+	return h.updateCNameRecord(cname)
+}
+
+// saveCName saves a validated cname entry to the database
+// and updates the entry on the DNS server.
+func (h *Handler) saveCName(cname *model.CName) (err error) {
+	if err = h.DB.Save(cname).Error; err != nil {
+		return err
+	}
+
+	return h.updateCNameRecord(cname)
+}
+
+// deleteCName deletes a cname entry from the database and the DNS server.
+func (h *Handler) deleteCName(cname *model.CName) (err error) {
+	if err = h.DB.Unscoped().Delete(cname).Error; err != nil {
+		return err
+	}
+
+	return h.DNS.DeleteRecord(cname.Hostname, cname.Target.Domain, h.AllowWildcard)
+}
+
+func (h *Handler) updateCNameRecord(cname *model.CName) error {
+	return h.DNS.UpdateRecord(cname.Hostname, fmt.Sprintf("%s.%s", cname.Target.Hostname, cname.Target.Domain), "CNAME", cname.Target.Domain, cname.Ttl, h.AllowWildcard)
+}
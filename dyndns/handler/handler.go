@@ -1,38 +1,74 @@
 package handler
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/labstack/gommon/log"
 
+	"net/http"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/benjaminbear/docker-ddns-server/dyndns/acme"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/dnsserver"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/metrics"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/migrate"
 	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/notify"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/nswrapper"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/ratelimit"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/webhook"
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 	"github.com/tg123/go-htpasswd"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 type Handler struct {
-	DB               *gorm.DB
-	AuthAdmin        bool
-	Config           Envs
-	Title            string
-	DisableAdminAuth bool
-	LastClearedLogs  time.Time
-	ClearInterval    uint64
-	AllowWildcard    bool
-	LogoutUrl        string
+	DB                 *gorm.DB
+	Config             Envs
+	Title              string
+	LogRetention       time.Duration
+	LogMaxPerHost      int
+	ForceRefresh       time.Duration
+	AllowWildcard      bool
+	TrustedProxies     nswrapper.TrustedProxies
+	ForwardedHeader    string
+	StaleCheckInterval time.Duration
+	LogoutUrl          string
+	DNS                nswrapper.DNSBackend
+	DNSServer          *dnsserver.Server
+	ACME               *acme.Manager
+
+	oidc        *oidcClient
+	hostLimit   *ratelimit.Limiter
+	sourceLimit *ratelimit.Limiter
+	authLockout *ratelimit.Limiter
+	notifier    notify.Notifier
+	notifying   sync.WaitGroup
+	webhooks    *webhook.Dispatcher
+	challengeMu sync.Mutex
+	challenges  map[uint][]string
 }
 
 type Envs struct {
-	AdminLogin string
-	Domains    []string
+	AdminLogin   string
+	MetricsLogin string
+	Listen       string
+	UpdateListen string
+	Domains      []string
+	DNS          nswrapper.Config
+	DNSListen    string
+	OIDC         OIDCConfig
 }
 
 type CustomValidator struct {
@@ -44,51 +80,114 @@ func (cv *CustomValidator) Validate(i interface{}) error {
 	return cv.Validator.Struct(i)
 }
 
+// dummyHash is compared against if an update user is unknown.
+// It is hashed on first use, with the cost of the stored passwords.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), model.PasswordCost)
+	return hash
+})
+
 type Error struct {
 	Message string `json:"message"`
 }
 
-// Authenticate is the method the website admin user and the host update user have to authenticate against.
-// To gather admin rights the username password combination must match with the credentials given by the env var.
+// AuthenticateUpdate is the method the host update user has to authenticate against.
+// All hosts sharing the username whose password matches are stored as "updateHosts" of the request.
 func (h *Handler) AuthenticateUpdate(username, password string, c echo.Context) (bool, error) {
-	h.CheckClearInterval()
-	reqParameter := c.QueryParam("hostname")
-	reqArr := strings.SplitN(reqParameter, ".", 2)
-	if len(reqArr) != 2 {
-		log.Error("Error: Something wrong with the hostname parameter")
-		return false, nil
+	ip := h.callerIP(c)
+	hosts := []model.Host{}
+	if username != "" {
+		if err := h.DB.Where("user_name = ?", username).Find(&hosts).Error; err != nil {
+			log.Error("Error: ", err)
+			return false, nil
+		}
 	}
 
-	host := &model.Host{}
-	if err := h.DB.Where(&model.Host{UserName: username, Password: password, Hostname: reqArr[0], Domain: reqArr[1]}).First(host).Error; err != nil {
-		log.Error("Error: ", err)
+	if len(hosts) == 0 {
+		// compare anyway, so unknown users can't be told apart by response time
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		log.Error("hostname or user credentials unknown")
+		h.authLockout.Allow(ip)
+		metrics.CountUpdate("badauth")
 		return false, nil
 	}
-	if host.ID == 0 {
-		log.Error("hostname or user user credentials unknown")
+
+	updateHosts := []model.Host{}
+	for _, host := range hosts {
+		if host.CheckPassword(password) {
+			updateHosts = append(updateHosts, host)
+		}
+	}
+	if len(updateHosts) == 0 {
+		log.Error("hostname or user credentials unknown")
+		h.authLockout.Allow(ip)
+		metrics.CountUpdate("badauth")
 		return false, nil
 	}
-	c.Set("updateHost", host)
+	c.Set("updateHosts", updateHosts)
 
 	return true, nil
 }
-func (h *Handler) AuthenticateAdmin(username, password string, c echo.Context) (bool, error) {
-	h.AuthAdmin = false
-	ok, err := h.authByEnv(username, password)
+
+// UpdateAuth authenticates update requests by basic auth against AuthenticateUpdate.
+// Missing and failed logins are answered with the dyndns2 result "badauth".
+func (h *Handler) UpdateAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	auth := middleware.BasicAuth(h.AuthenticateUpdate)(next)
+
+	return func(c echo.Context) error {
+		err := auth(c)
+		if err == echo.ErrUnauthorized && !c.Response().Committed {
+			return c.String(http.StatusUnauthorized, "badauth\n")
+		}
+
+		return err
+	}
+}
+
+// AuthenticateMetrics validates the login of /metrics given by DDNS_METRICS_LOGIN.
+func (h *Handler) AuthenticateMetrics(username, password string, c echo.Context) (bool, error) {
+	ok, err := authByEnv(h.Config.MetricsLogin, username, password)
 	if err != nil {
 		log.Error("Error:", err)
 		return false, nil
 	}
 
-	if ok {
-		h.AuthAdmin = true
-		return true, nil
+	return ok, nil
+}
+
+// AuthenticateAdmin validates the admin login and stores the admin as principal of the request.
+// The login given by DDNS_ADMIN_LOGIN is an owner, all other admins are looked up in the database.
+func (h *Handler) AuthenticateAdmin(username, password string, c echo.Context) (bool, error) {
+	if h.Config.AdminLogin != "" {
+		ok, err := authByEnv(h.Config.AdminLogin, username, password)
+		if err != nil {
+			log.Error("Error:", err)
+			return false, nil
+		}
+
+		if ok {
+			setPrincipal(c, &Principal{Name: username, Role: model.RoleOwner})
+			return true, nil
+		}
 	}
 
-	return false, nil
+	user := &model.User{}
+	if err := h.DB.Where(&model.User{UserName: username}).First(user).Error; err != nil {
+		// compare anyway, so unknown users can't be told apart by response time
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return false, nil
+	}
+
+	if !user.CheckPassword(password) {
+		return false, nil
+	}
+
+	setPrincipal(c, &Principal{Name: user.UserName, Role: user.Role, User: user})
+
+	return true, nil
 }
-func (h *Handler) authByEnv(username, password string) (bool, error) {
-	hashReader := strings.NewReader(h.Config.AdminLogin)
+func authByEnv(login, username, password string) (bool, error) {
+	hashReader := strings.NewReader(login)
 
 	pw, err := htpasswd.NewFromReader(hashReader, htpasswd.DefaultSystems, nil)
 	if err != nil {
@@ -104,18 +203,42 @@ func (h *Handler) authByEnv(username, password string) (bool, error) {
 
 // ParseEnvs parses all needed environment variables:
 // DDNS_ADMIN_LOGIN: The basic auth login string in htpasswd style.
+// DDNS_LISTEN: The address the admin ui, the JSON API and /metrics listen on (default: :8080), with https if DDNS_ACME_DOMAINS is set.
+// DDNS_UPDATE_LISTEN: The address the update endpoints listen on via plain http (default: DDNS_LISTEN).
+// DDNS_ACME_DOMAINS, DDNS_ACME_EMAIL, DDNS_ACME_CA: The names, contact and CA directory of the ACME certificate.
+// DDNS_ACME_PROPAGATION_DELAY: The time the challenge records get to propagate (default: 10s).
 // DDNS_DOMAINS: All domains that will be handled by the dyndns server.
-func (h *Handler) ParseEnvs() (adminAuth bool, err error) {
+// DDNS_DNS_BACKEND: The DNS backend the records are pushed to, nsupdate, rfc2136 or builtin (default: nsupdate).
+// DDNS_DNS_SERVER: The name server the DNS backend talks to (default: localhost).
+// DDNS_DNS_PORT: The port of the name server used by the rfc2136 backend (default: 53).
+// DDNS_TSIG_KEY_NAME, DDNS_TSIG_SECRET: The HMAC-SHA256 TSIG key the rfc2136 backend signs updates with.
+// DDNS_DNS_LISTEN: The address the builtin name server listens on (default: :53).
+// DDNS_PARENT_NS, DDNS_DEFAULT_TTL: The name server and ttl the builtin name server publishes in SOA and NS records.
+// DDNS_OIDC_ISSUER, DDNS_OIDC_CLIENT_ID, DDNS_OIDC_CLIENT_SECRET, DDNS_OIDC_REDIRECT_URL: The OpenID Connect login of the admin ui.
+// DDNS_OIDC_GROUPS_CLAIM: The ID token claim holding the groups of a user (default: groups).
+// DDNS_OIDC_OWNER_GROUPS, DDNS_OIDC_OPERATOR_GROUPS, DDNS_OIDC_VIEWER_GROUPS: The groups granting an admin role.
+// DDNS_SESSION_TTL: The lifetime of a login session (default: 12h).
+// DDNS_CLEAR_LOG_INTERVAL, DDNS_LOG_MAX_PER_HOST: The days and number of entries per host log entries are kept.
+// DDNS_FORCE_REFRESH_DAYS: The days after which unchanged addresses are pushed to the DNS backend again.
+// DDNS_TRUSTED_PROXIES: The proxies whose forwarded header is honored (default: none).
+// DDNS_FORWARDED_HEADER: The header the trusted proxies set (default: X-Forwarded-For).
+// DDNS_RATE_LIMIT_HOST, DDNS_RATE_LIMIT_IP, DDNS_AUTH_LOCKOUT: The rate limits of the update endpoints.
+// DDNS_METRICS_LOGIN: The basic auth login of /metrics in htpasswd style.
+// DDNS_STALE_CHECK_INTERVAL: The interval hosts are checked for overdue updates (default: 5m).
+// DDNS_NOTIFY_*: The channels stale hosts are notified through.
+func (h *Handler) ParseEnvs() (err error) {
 	log.Info("Read environment variables")
 	h.Config = Envs{}
-	adminAuth = true
 	h.Config.AdminLogin = os.Getenv("DDNS_ADMIN_LOGIN")
+	h.Config.MetricsLogin = os.Getenv("DDNS_METRICS_LOGIN")
 	if h.Config.AdminLogin == "" {
-		log.Info("No Auth! DDNS_ADMIN_LOGIN should be set")
-		adminAuth = false
-		h.AuthAdmin = true
-		h.DisableAdminAuth = true
+		log.Info("No Auth! DDNS_ADMIN_LOGIN should be set or admin users be created")
+	}
+	h.Config.Listen = os.Getenv("DDNS_LISTEN")
+	if h.Config.Listen == "" {
+		h.Config.Listen = ":8080"
 	}
+	h.Config.UpdateListen = os.Getenv("DDNS_UPDATE_LISTEN")
 	var ok bool
 	h.Title, ok = os.LookupEnv("DDNS_TITLE")
 	if !ok {
@@ -136,28 +259,171 @@ func (h *Handler) ParseEnvs() (adminAuth bool, err error) {
 		}
 	}
 
-	clearEnv := os.Getenv("DDNS_CLEAR_LOG_INTERVAL")
-	clearInterval, err := strconv.ParseUint(clearEnv, 10, 32)
-	if err != nil {
-		log.Info("No log clear interval found")
-	} else {
-		log.Info("log clear interval found: ", clearInterval, "days")
-		h.ClearInterval = clearInterval
-		if clearInterval > 0 {
-			h.LastClearedLogs = time.Now()
+	if err = h.initRetention(); err != nil {
+		return err
+	}
+
+	refreshEnv := os.Getenv("DDNS_FORCE_REFRESH_DAYS")
+	if refreshEnv != "" {
+		refreshDays, err := strconv.ParseUint(refreshEnv, 10, 32)
+		if err != nil {
+			return fmt.Errorf("environment variable DDNS_FORCE_REFRESH_DAYS is invalid: %w", err)
+		}
+		log.Info("Force refresh of unchanged addresses after ", refreshDays, " days")
+		h.ForceRefresh = time.Duration(refreshDays) * 24 * time.Hour
+	}
+
+	if proxies := os.Getenv("DDNS_TRUSTED_PROXIES"); proxies != "" && proxies != "none" {
+		if h.TrustedProxies, err = nswrapper.ParseTrustedProxies(splitList(proxies)); err != nil {
+			return fmt.Errorf("environment variable DDNS_TRUSTED_PROXIES is invalid: %w", err)
 		}
+		log.Info("Trusted proxies set: ", proxies)
+	}
+
+	h.ForwardedHeader = nswrapper.DefaultForwardedHeader
+	if header := os.Getenv("DDNS_FORWARDED_HEADER"); header != "" {
+		if h.ForwardedHeader, err = nswrapper.ParseForwardedHeader(header); err != nil {
+			return fmt.Errorf("environment variable DDNS_FORWARDED_HEADER is invalid: %w", err)
+		}
+		log.Info("Forwarded header set: ", h.ForwardedHeader)
+	}
+
+	if err = h.initRateLimits(); err != nil {
+		return err
+	}
+
+	if err = h.initNotify(); err != nil {
+		return err
 	}
 
+	h.webhooks = webhook.NewDispatcher(h.DB)
+
 	h.Config.Domains = strings.Split(os.Getenv("DDNS_DOMAINS"), ",")
 	if len(h.Config.Domains) < 1 {
-		return adminAuth, fmt.Errorf("environment variable DDNS_DOMAINS has to be set")
+		return fmt.Errorf("environment variable DDNS_DOMAINS has to be set")
+	}
+
+	if err = h.initOIDC(); err != nil {
+		return err
+	}
+
+	h.Config.DNS = nswrapper.Config{
+		Backend:     os.Getenv("DDNS_DNS_BACKEND"),
+		Server:      os.Getenv("DDNS_DNS_SERVER"),
+		Port:        os.Getenv("DDNS_DNS_PORT"),
+		TsigKeyName: os.Getenv("DDNS_TSIG_KEY_NAME"),
+		TsigSecret:  os.Getenv("DDNS_TSIG_SECRET"),
+	}
+	if h.Config.DNS.Backend == "builtin" {
+		err = h.initDNSServer()
+	} else {
+		h.DNS, err = nswrapper.NewBackend(h.Config.DNS)
+	}
+	if err != nil {
+		return err
+	}
+
+	backendName := h.Config.DNS.Backend
+	if backendName == "" {
+		backendName = "rfc2136"
+	}
+	h.DNS = metrics.InstrumentBackend(h.DNS, backendName)
+
+	return h.initACME()
+}
+
+// initOIDC creates the OpenID Connect client, if an issuer is configured.
+func (h *Handler) initOIDC() (err error) {
+	h.Config.OIDC = OIDCConfig{
+		Issuer:         os.Getenv("DDNS_OIDC_ISSUER"),
+		ClientID:       os.Getenv("DDNS_OIDC_CLIENT_ID"),
+		ClientSecret:   os.Getenv("DDNS_OIDC_CLIENT_SECRET"),
+		RedirectURL:    os.Getenv("DDNS_OIDC_REDIRECT_URL"),
+		GroupsClaim:    os.Getenv("DDNS_OIDC_GROUPS_CLAIM"),
+		OwnerGroups:    splitList(os.Getenv("DDNS_OIDC_OWNER_GROUPS")),
+		OperatorGroups: splitList(os.Getenv("DDNS_OIDC_OPERATOR_GROUPS")),
+		ViewerGroups:   splitList(os.Getenv("DDNS_OIDC_VIEWER_GROUPS")),
+		SessionTTL:     defaultSessionTTL,
+	}
+	if h.Config.OIDC.GroupsClaim == "" {
+		h.Config.OIDC.GroupsClaim = "groups"
+	}
+
+	if ttl := os.Getenv("DDNS_SESSION_TTL"); ttl != "" {
+		if h.Config.OIDC.SessionTTL, err = time.ParseDuration(ttl); err != nil {
+			return fmt.Errorf("environment variable DDNS_SESSION_TTL is invalid: %w", err)
+		}
+	}
+
+	if h.Config.OIDC.Issuer == "" {
+		return nil
+	}
+
+	if h.Config.OIDC.ClientID == "" || h.Config.OIDC.RedirectURL == "" {
+		return fmt.Errorf("environment variables DDNS_OIDC_CLIENT_ID and DDNS_OIDC_REDIRECT_URL have to be set for the oidc login")
+	}
+
+	if len(h.Config.OIDC.OwnerGroups)+len(h.Config.OIDC.OperatorGroups)+len(h.Config.OIDC.ViewerGroups) == 0 {
+		return fmt.Errorf("at least one of DDNS_OIDC_OWNER_GROUPS, DDNS_OIDC_OPERATOR_GROUPS or DDNS_OIDC_VIEWER_GROUPS has to be set")
+	}
+
+	h.oidc, err = newOIDCClient(context.Background(), h.Config.OIDC)
+	if err != nil {
+		return err
 	}
+	log.Info("OIDC login enabled: ", h.Config.OIDC.Issuer)
 
-	return adminAuth, nil
+	return nil
 }
 
-// InitDB creates an empty database and creates all tables if there isn't already one, or opens the existing one.
-func (h *Handler) InitDB() (err error) {
+// splitList splits a comma separated list and drops empty entries.
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// initDNSServer creates the builtin name server, which answers queries straight from the database.
+func (h *Handler) initDNSServer() error {
+	parentNS := os.Getenv("DDNS_PARENT_NS")
+	if parentNS == "" {
+		return fmt.Errorf("environment variable DDNS_PARENT_NS has to be set for the builtin dns server")
+	}
+
+	ttl, err := strconv.Atoi(os.Getenv("DDNS_DEFAULT_TTL"))
+	if err != nil {
+		return fmt.Errorf("environment variable DDNS_DEFAULT_TTL has to be set for the builtin dns server: %v", err)
+	}
+
+	h.Config.DNSListen = os.Getenv("DDNS_DNS_LISTEN")
+	if h.Config.DNSListen == "" {
+		h.Config.DNSListen = ":53"
+	}
+
+	h.DNSServer = dnsserver.New(h.DB, h.Config.Domains, parentNS, ttl, h.AllowWildcard)
+	h.DNS = h.DNSServer
+
+	return nil
+}
+
+// InitDB opens the database and applies pending schema migrations.
+func (h *Handler) InitDB() error {
+	if err := h.OpenDB(); err != nil {
+		return err
+	}
+
+	return migrate.Up(h.DB)
+}
+
+// OpenDB opens the database without migrating it.
+// The database is selected by DDNS_DB_DRIVER (sqlite, postgres or mysql) and DDNS_DB_DSN,
+// it defaults to the sqlite file database/ddns.db.
+func (h *Handler) OpenDB() (err error) {
 	if _, err := os.Stat("database"); os.IsNotExist(err) {
 		err = os.MkdirAll("database", os.ModePerm)
 		if err != nil {
@@ -165,28 +431,50 @@ func (h *Handler) InitDB() (err error) {
 		}
 	}
 
-	h.DB, err = gorm.Open(sqlite.Open("database/ddns.db"), &gorm.Config{})
+	dialector, err := openDialector(os.Getenv("DDNS_DB_DRIVER"), os.Getenv("DDNS_DB_DSN"))
 	if err != nil {
 		return err
 	}
 
-	err = h.DB.AutoMigrate(&model.Host{}, &model.CName{}, &model.Log{})
+	h.DB, err = gorm.Open(dialector, &gorm.Config{})
 
 	return err
 }
 
-// Check if a log cleaning is needed
-func (h *Handler) CheckClearInterval() {
-	if !h.LastClearedLogs.IsZero() {
-		if !DateEqual(time.Now(), h.LastClearedLogs) {
-			go h.ClearLogs()
-		}
+// Close waits for pending webhook deliveries and notifications and closes the database.
+func (h *Handler) Close() error {
+	h.webhooks.Close()
+	h.notifying.Wait()
+
+	sqlDB, err := h.DB.DB()
+	if err != nil {
+		return err
 	}
+
+	return sqlDB.Close()
 }
 
-// compare two dates
-func DateEqual(date1, date2 time.Time) bool {
-	y1, m1, d1 := date1.Date()
-	y2, m2, d2 := date2.Date()
-	return y1 == y2 && m1 == m2 && d1 == d2
+// openDialector returns the gorm dialector of driver connecting to dsn.
+func openDialector(driver string, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case "", "sqlite":
+		if dsn == "" {
+			dsn = "database/ddns.db"
+		}
+		return sqlite.Open(dsn), nil
+	case "postgres":
+		return postgres.Open(dsn), nil
+	case "mysql":
+		// time columns are only scanned into time.Time with parseTime
+		if !strings.Contains(dsn, "parseTime=") {
+			if strings.Contains(dsn, "?") {
+				dsn += "&parseTime=true"
+			} else {
+				dsn += "?parseTime=true"
+			}
+		}
+		return mysql.Open(dsn), nil
+	default:
+		return nil, fmt.Errorf("environment variable DDNS_DB_DRIVER is invalid: %s", driver)
+	}
 }
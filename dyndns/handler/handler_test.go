@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestMain hashes the passwords of the test fixtures with the minimum cost to keep the tests fast.
+func TestMain(m *testing.M) {
+	model.PasswordCost = bcrypt.MinCost
+	os.Exit(m.Run())
+}
+
+func TestAuthenticateUpdateToVerifyHashedPassword(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.DB.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ttl: 60, UserName: "bloguser", Password: "blogpassword"})
+
+	stored := &model.Host{}
+	h.DB.First(stored)
+	if !model.IsPasswordHash(stored.Password) {
+		t.Fatalf("Expected password to be stored hashed but got %s", stored.Password)
+	}
+
+	e := newTestEcho()
+	req := httptest.NewRequest(http.MethodGet, "/update?hostname=blog.dyndns.example.com", nil)
+	c := e.NewContext(req, httptest.NewRecorder())
+
+	if ok, _ := h.AuthenticateUpdate("bloguser", "blogpassword", c); !ok {
+		t.Fatalf("Expected valid credentials to be accepted")
+	}
+
+	if ok, _ := h.AuthenticateUpdate("bloguser", "wrongpassword", c); ok {
+		t.Fatalf("Expected wrong password to be rejected")
+	}
+
+	if ok, _ := h.AuthenticateUpdate("bloguser", stored.Password, c); ok {
+		t.Fatalf("Expected the password hash to be rejected")
+	}
+}
+
+func TestAuthenticateUpdateToHashPasswordsLookingLikeHashes(t *testing.T) {
+	h, _ := newTestHandler(t)
+	password, _ := model.HashPassword("blogpassword")
+	h.DB.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ttl: 60, UserName: "bloguser", Password: password})
+
+	// saving a loaded host keeps its hash
+	stored := &model.Host{}
+	h.DB.First(stored)
+	stored.Ttl = 120
+	h.DB.Save(stored)
+
+	e := newTestEcho()
+	req := httptest.NewRequest(http.MethodGet, "/update?hostname=blog.dyndns.example.com", nil)
+	c := e.NewContext(req, httptest.NewRecorder())
+
+	if ok, _ := h.AuthenticateUpdate("bloguser", password, c); !ok {
+		t.Fatalf("Expected password looking like a hash to be accepted")
+	}
+
+	if ok, _ := h.AuthenticateUpdate("bloguser", "blogpassword", c); ok {
+		t.Fatalf("Expected password not to be taken as hash")
+	}
+}
+
+func TestOpenDialectorToSelectDriver(t *testing.T) {
+	for driver, name := range map[string]string{"": "sqlite", "sqlite": "sqlite", "postgres": "postgres", "mysql": "mysql"} {
+		dialector, err := openDialector(driver, "")
+		if err != nil || dialector.Name() != name {
+			t.Fatalf("Expected dialector %s for driver %q but got %v", name, driver, err)
+		}
+	}
+
+	if _, err := openDialector("oracle", ""); err == nil {
+		t.Fatal("Expected error for unknown driver")
+	}
+}
+
+// updateRequest authenticates username and password and runs an update with query.
+func updateRequest(t *testing.T, h *Handler, username string, password string, query string) string {
+	e := newTestEcho()
+	req := httptest.NewRequest(http.MethodGet, "/update?"+query, nil)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+
+	if ok, _ := h.AuthenticateUpdate(username, password, c); !ok {
+		t.Fatalf("Expected credentials of %s to be accepted", username)
+	}
+
+	if err := h.UpdateIP(c); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	return rec.Body.String()
+}
+
+func TestUpdateIPToUpdateBothAddressFamilies(t *testing.T) {
+	h, backend := newTestHandler(t)
+	h.DB.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ipv4: "1.1.1.1", Ttl: 60, UserName: "bloguser", Password: "blogpassword"})
+
+	body := updateRequest(t, h, "bloguser", "blogpassword", "hostname=blog.dyndns.example.com&myip=1.2.3.4,2001:db8::1")
+	if body != "good 1.2.3.4,2001:db8::1\n" {
+		t.Fatalf("Expected good but got %s", body)
+	}
+
+	if len(backend.updates) != 2 || backend.updates[0] != "blog.dyndns.example.com A 1.2.3.4" || backend.updates[1] != "blog.dyndns.example.com AAAA 2001:db8::1" {
+		t.Fatalf("Expected A and AAAA record updates but got %v", backend.updates)
+	}
+
+	stored := &model.Host{}
+	h.DB.First(stored)
+	if stored.Ipv4 != "1.2.3.4" || stored.Ipv6 != "2001:db8::1" || stored.Ipv4LastUpdate.IsZero() || stored.Ipv6LastUpdate.IsZero() {
+		t.Fatalf("Expected both addresses to be stored but got %+v", stored)
+	}
+}
+
+func TestUpdateIPToSkipDNSForUnchangedAddress(t *testing.T) {
+	h, backend := newTestHandler(t)
+	h.DB.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ipv4: "1.2.3.4", Ttl: 60, UserName: "bloguser", Password: "blogpassword"})
+
+	body := updateRequest(t, h, "bloguser", "blogpassword", "hostname=blog.dyndns.example.com&myip=1.2.3.4")
+	if body != "nochg 1.2.3.4\n" {
+		t.Fatalf("Expected nochg but got %s", body)
+	}
+
+	if len(backend.updates) != 0 {
+		t.Fatalf("Expected no record update but got %v", backend.updates)
+	}
+
+	log := &model.Log{}
+	h.DB.First(log)
+	if !log.Status || !log.Unchanged {
+		t.Fatalf("Expected successful unchanged log entry but got %+v", log)
+	}
+}
+
+func TestUpdateIPToRefreshUnchangedAddressAfterInterval(t *testing.T) {
+	h, backend := newTestHandler(t)
+	h.ForceRefresh = 24 * time.Hour
+	h.DB.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ipv4: "1.2.3.4", LastUpdate: time.Now().Add(-48 * time.Hour), Ttl: 60, UserName: "bloguser", Password: "blogpassword"})
+
+	body := updateRequest(t, h, "bloguser", "blogpassword", "hostname=blog.dyndns.example.com&myip=1.2.3.4")
+	if body != "good 1.2.3.4\n" || len(backend.updates) != 1 {
+		t.Fatalf("Expected refreshed record but got %s and %v", body, backend.updates)
+	}
+
+	body = updateRequest(t, h, "bloguser", "blogpassword", "hostname=blog.dyndns.example.com&myip=1.2.3.4")
+	if body != "nochg 1.2.3.4\n" || len(backend.updates) != 1 {
+		t.Fatalf("Expected no refresh within interval but got %s and %v", body, backend.updates)
+	}
+}
+
+func TestUpdateIPToAnswerEachHostname(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.DB.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ttl: 60, UserName: "bloguser", Password: "blogpassword"})
+	h.DB.Create(&model.Host{Hostname: "shop", Domain: "dyndns.example.com", Ttl: 60, UserName: "bloguser", Password: "blogpassword"})
+	h.DB.Create(&model.Host{Hostname: "spam", Domain: "dyndns.example.com", Ttl: 60, UserName: "bloguser", Password: "blogpassword", Blocked: true})
+	h.DB.Create(&model.Host{Hostname: "other", Domain: "dyndns.example.com", Ttl: 60, UserName: "otheruser", Password: "otherpassword"})
+
+	body := updateRequest(t, h, "bloguser", "blogpassword", "hostname=blog.dyndns.example.com,shop.dyndns.example.com,spam.dyndns.example.com,other.dyndns.example.com,none.dyndns.example.com,local&myip=1.2.3.4")
+	expected := "good 1.2.3.4\ngood 1.2.3.4\nabuse\n!yours\nnohost\nnotfqdn\n"
+	if body != expected {
+		t.Fatalf("Expected %q but got %q", expected, body)
+	}
+}
+
+func TestSplitIPsToPickFirstAddressPerFamily(t *testing.T) {
+	ipv4, ipv6 := splitIPs("invalid, 2001:db8::1,1.2.3.4,5.6.7.8", "2001:db8::2")
+	if ipv4 != "1.2.3.4" || ipv6 != "2001:db8::1" {
+		t.Fatalf("Expected 1.2.3.4 and 2001:db8::1 but got %s and %s", ipv4, ipv6)
+	}
+}
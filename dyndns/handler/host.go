@@ -1,14 +1,16 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
-	"net"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	l "github.com/labstack/gommon/log"
 
+	"github.com/benjaminbear/docker-ddns-server/dyndns/metrics"
 	"github.com/benjaminbear/docker-ddns-server/dyndns/nswrapper"
 
 	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
@@ -20,9 +22,11 @@ const (
 	UNAUTHORIZED = "You are not allowed to view that content"
 )
 
+var errHostnameExists = errors.New("hostname already exists")
+
 // GetHost fetches a host from the database by "id".
 func (h *Handler) GetHost(c echo.Context) (err error) {
-	if !h.AuthAdmin {
+	if GetPrincipal(c) == nil {
 		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
 	}
 
@@ -32,7 +36,7 @@ func (h *Handler) GetHost(c echo.Context) (err error) {
 	}
 
 	host := &model.Host{}
-	if err = h.DB.First(host, id).Error; err != nil {
+	if err = h.DB.Scopes(tenantHosts(c)).First(host, id).Error; err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
@@ -42,12 +46,12 @@ func (h *Handler) GetHost(c echo.Context) (err error) {
 
 // ListHosts fetches all hosts from database and lists them on the website.
 func (h *Handler) ListHosts(c echo.Context) (err error) {
-	if !h.AuthAdmin {
+	if GetPrincipal(c) == nil {
 		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
 	}
 
 	hosts := new([]model.Host)
-	if err = h.DB.Find(hosts).Error; err != nil {
+	if err = h.DB.Scopes(tenantHosts(c)).Find(hosts).Error; err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
@@ -59,20 +63,21 @@ func (h *Handler) ListHosts(c echo.Context) (err error) {
 
 // AddHost just renders the "add host" website.
 func (h *Handler) AddHost(c echo.Context) (err error) {
-	if !h.AuthAdmin {
+	if GetPrincipal(c) == nil {
 		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
 	}
 
 	return c.Render(http.StatusOK, "edithost", echo.Map{
 		"addEdit": "add",
 		"config":  h.Config,
+		"domains": h.tenantDomains(c),
 		"title":   h.Title,
 	})
 }
 
 // EditHost fetches a host by "id" and renders the "edit host" website.
 func (h *Handler) EditHost(c echo.Context) (err error) {
-	if !h.AuthAdmin {
+	if GetPrincipal(c) == nil {
 		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
 	}
 
@@ -82,7 +87,7 @@ func (h *Handler) EditHost(c echo.Context) (err error) {
 	}
 
 	host := &model.Host{}
-	if err = h.DB.First(host, id).Error; err != nil {
+	if err = h.DB.Scopes(tenantHosts(c)).First(host, id).Error; err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
@@ -90,6 +95,7 @@ func (h *Handler) EditHost(c echo.Context) (err error) {
 		"host":    host,
 		"addEdit": "edit",
 		"config":  h.Config,
+		"domains": h.tenantDomains(c),
 		"title":   h.Title,
 	})
 }
@@ -98,7 +104,7 @@ func (h *Handler) EditHost(c echo.Context) (err error) {
 // adds the host entry to the database,
 // and adds the entry to the DNS server.
 func (h *Handler) CreateHost(c echo.Context) (err error) {
-	if !h.AuthAdmin {
+	if GetPrincipal(c) == nil {
 		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
 	}
 
@@ -111,25 +117,15 @@ func (h *Handler) CreateHost(c echo.Context) (err error) {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
-	if err = h.checkUniqueHostname(host.Hostname, host.Domain); err != nil {
-		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	if err = applyTenant(c, host); err != nil {
+		return c.JSON(http.StatusForbidden, &Error{err.Error()})
 	}
-	host.LastUpdate = time.Now()
-	if err = h.DB.Create(host).Error; err != nil {
+
+	if err = h.createHost(host); err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
-	// If a ip is set create dns entry
-	if host.Ip != "" {
-		ipType := nswrapper.GetIPType(host.Ip)
-		if ipType == "" {
-			return c.JSON(http.StatusBadRequest, &Error{fmt.Sprintf("ip %s is not a valid ip", host.Ip)})
-		}
-
-		if err = nswrapper.UpdateRecord(host.Hostname, host.Ip, ipType, host.Domain, host.Ttl, h.AllowWildcard); err != nil {
-			return c.JSON(http.StatusBadRequest, &Error{err.Error()})
-		}
-	}
+	h.audit(c, "create host", host.Hostname+"."+host.Domain)
 
 	return c.JSON(http.StatusOK, host)
 }
@@ -138,7 +134,7 @@ func (h *Handler) CreateHost(c echo.Context) (err error) {
 // and compares the host data with the entry in the database by "id".
 // If anything has changed the database and DNS entries for the host will be updated.
 func (h *Handler) UpdateHost(c echo.Context) (err error) {
-	if !h.AuthAdmin {
+	if GetPrincipal(c) == nil {
 		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
 	}
 
@@ -153,7 +149,7 @@ func (h *Handler) UpdateHost(c echo.Context) (err error) {
 	}
 
 	host := &model.Host{}
-	if err = h.DB.First(host, id).Error; err != nil {
+	if err = h.DB.Scopes(tenantHosts(c)).First(host, id).Error; err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
@@ -162,21 +158,11 @@ func (h *Handler) UpdateHost(c echo.Context) (err error) {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
-	if err = h.DB.Save(host).Error; err != nil {
+	if err = h.saveHost(host, forceRecordUpdate); err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
-	// If ip or ttl changed update dns entry
-	if forceRecordUpdate {
-		ipType := nswrapper.GetIPType(host.Ip)
-		if ipType == "" {
-			return c.JSON(http.StatusBadRequest, &Error{fmt.Sprintf("ip %s is not a valid ip", host.Ip)})
-		}
-
-		if err = nswrapper.UpdateRecord(host.Hostname, host.Ip, ipType, host.Domain, host.Ttl, h.AllowWildcard); err != nil {
-			return c.JSON(http.StatusBadRequest, &Error{err.Error()})
-		}
-	}
+	h.audit(c, "update host", host.Hostname+"."+host.Domain)
 
 	return c.JSON(http.StatusOK, host)
 }
@@ -184,7 +170,7 @@ func (h *Handler) UpdateHost(c echo.Context) (err error) {
 // DeleteHost fetches a host entry from the database by "id"
 // and deletes the database and DNS server entry to it.
 func (h *Handler) DeleteHost(c echo.Context) (err error) {
-	if !h.AuthAdmin {
+	if GetPrincipal(c) == nil {
 		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
 	}
 
@@ -194,113 +180,341 @@ func (h *Handler) DeleteHost(c echo.Context) (err error) {
 	}
 
 	host := &model.Host{}
-	if err = h.DB.First(host, id).Error; err != nil {
+	if err = h.DB.Scopes(tenantHosts(c)).First(host, id).Error; err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
-	err = h.DB.Transaction(func(tx *gorm.DB) error {
-		if err = tx.Unscoped().Delete(host).Error; err != nil {
-			return c.JSON(http.StatusBadRequest, &Error{err.Error()})
-		}
-
-		if err = tx.Where(&model.Log{HostID: uint(id)}).Delete(&model.Log{}).Error; err != nil {
-			return c.JSON(http.StatusBadRequest, &Error{err.Error()})
-		}
-
-		if err = tx.Where(&model.CName{TargetID: uint(id)}).Delete(&model.CName{}).Error; err != nil {
-			return c.JSON(http.StatusBadRequest, &Error{err.Error()})
-		}
-
-		return nil
-	})
-	if err != nil {
+	if err = h.deleteHost(host); err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
-	if err = nswrapper.DeleteRecord(host.Hostname, host.Domain, h.AllowWildcard); err != nil {
-		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
-	}
+	h.audit(c, "delete host", host.Hostname+"."+host.Domain)
 
 	return c.JSON(http.StatusOK, id)
 }
 
-// UpdateIP implements the update method called by the routers.
-// Hostname, IP and senders IP are validated, a log entry is created
-// and finally if everything is ok, the DNS Server will be updated
+// maxUpdateHosts is the number of hostnames a single update request may contain.
+const maxUpdateHosts = 20
+
+// UpdateIP implements the dyndns2 update protocol called by the routers.
+// The "hostname" parameter may contain several comma separated hosts,
+// each of them is answered by one result line in the same order.
+// An IPv4 and an IPv6 address can be sent at once by "myip" as comma separated list or by "myipv6",
+// the A and AAAA record are updated independently.
 func (h *Handler) UpdateIP(c echo.Context) (err error) {
-	host, ok := c.Get("updateHost").(*model.Host)
+	updateHosts, ok := c.Get("updateHosts").([]model.Host)
 	if !ok {
-		return c.String(http.StatusBadRequest, "badauth\n")
+		return c.String(http.StatusUnauthorized, "badauth\n")
 	}
 
-	log := &model.Log{Status: false, Host: *host, TimeStamp: time.Now(), UserAgent: nswrapper.ShrinkUserAgent(c.Request().UserAgent())}
-	log.SentIP = c.QueryParam(("myip"))
+	ipv4, ipv6 := splitIPs(c.QueryParam("myip"), c.QueryParam("myipv6"))
 
 	// Get caller IP
-	log.CallerIP, _ = nswrapper.GetCallerIP(c.Request())
-	if log.CallerIP == "" {
-		log.CallerIP, _, err = net.SplitHostPort(c.Request().RemoteAddr)
-		if err != nil {
-			log.Message = "Bad Request: Unable to get caller IP"
-			if err = h.CreateLogEntry(log); err != nil {
-				l.Error(err)
-			}
+	callerIP, err := nswrapper.GetCallerIP(c.Request(), h.TrustedProxies, h.ForwardedHeader)
+	if err != nil {
+		l.Error("Unable to get caller IP: ", err)
+		metrics.CountUpdate("911")
+		return c.String(http.StatusOK, "911\n")
+	}
+
+	// Fall back to the caller IP, if no valid IP has been sent
+	if ipv4 == "" && ipv6 == "" {
+		ipv4, ipv6 = splitIPs(callerIP)
+	}
+
+	hostnames := splitList(c.QueryParam("hostname"))
+	if len(hostnames) == 0 {
+		metrics.CountUpdate("notfqdn")
+		return c.String(http.StatusOK, "notfqdn\n")
+	}
+	if len(hostnames) > maxUpdateHosts {
+		metrics.CountUpdate("numhost")
+		return c.String(http.StatusOK, "numhost\n")
+	}
 
-			return c.String(http.StatusBadRequest, "badrequest\n")
+	results := []string{}
+	for _, hostname := range hostnames {
+		log := &model.Log{
+			TimeStamp: time.Now(),
+			SentIP:    strings.Trim(ipv4+","+ipv6, ","),
+			CallerIP:  callerIP,
+			UserAgent: nswrapper.ShrinkUserAgent(c.Request().UserAgent()),
 		}
+		result := h.updateHostIP(updateHosts, hostname, ipv4, ipv6, log)
+		metrics.CountUpdate(result)
+		results = append(results, result)
 	}
 
-	// Validate hostname
-	hostname := c.QueryParam("hostname")
-	if hostname == "" || hostname != host.Hostname+"."+host.Domain {
-		log.Message = "Hostname or combination of authenticated user and hostname is invalid"
-		if err = h.CreateLogEntry(log); err != nil {
-			l.Error(err)
+	return c.String(http.StatusOK, strings.Join(results, "\n")+"\n")
+}
+
+// updateHostIP updates the addresses of a single host of an update request
+// and returns its dyndns2 result: good, nochg, notfqdn, nohost, !yours, abuse, dnserr or 911.
+// DNS records are only updated for addresses, which changed,
+// unless the last update of the host is older than the force refresh interval.
+func (h *Handler) updateHostIP(updateHosts []model.Host, hostname string, ipv4 string, ipv6 string, log *model.Log) string {
+	reqArr := strings.SplitN(hostname, ".", 2)
+	if len(reqArr) != 2 || reqArr[0] == "" || reqArr[1] == "" {
+		l.Error("Hostname is not a fully qualified domain name: ", hostname)
+		return "notfqdn"
+	}
+
+	host := &model.Host{}
+	if err := h.DB.Where("hostname = ? AND domain = ?", reqArr[0], reqArr[1]).First(host).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			l.Error("Hostname unknown: ", hostname)
+			return "nohost"
 		}
 
-		return c.String(http.StatusBadRequest, "notfqdn\n")
+		l.Error(err)
+		return "911"
 	}
+	log.Host = *host
 
-	// Get IP type
-	ipType := nswrapper.GetIPType(log.SentIP)
-	if ipType == "" {
-		log.SentIP = log.CallerIP
-		ipType = nswrapper.GetIPType(log.SentIP)
-		if ipType == "" {
-			log.Message = "Bad Request: Sent IP is invalid"
-			if err = h.CreateLogEntry(log); err != nil {
-				l.Error(err)
-			}
+	if !containsHost(updateHosts, host.ID) {
+		return h.logUpdate(log, "Hostname is not owned by the authenticated user", "!yours")
+	}
 
-			return c.String(http.StatusBadRequest, "badrequest\n")
-		}
+	if host.Blocked {
+		return h.logUpdate(log, "Host is blocked", "abuse")
 	}
 
-	// Add/update DNS record
-	if err = nswrapper.UpdateRecord(log.Host.Hostname, log.SentIP, ipType, log.Host.Domain, log.Host.Ttl, h.AllowWildcard); err != nil {
-		log.Message = fmt.Sprintf("DNS error: %v", err)
-		l.Error(log.Message)
-		if err = h.CreateLogEntry(log); err != nil {
-			l.Error(err)
+	if !h.hostLimit.Allow(strconv.FormatUint(uint64(host.ID), 10)) {
+		return h.logUpdate(log, "Rate limit of the host exceeded", "abuse")
+	}
+
+	if ipv4 == "" && ipv6 == "" {
+		return h.logUpdate(log, "Bad Request: Sent IP is invalid", "911")
+	}
+	h.markSeen(host, log.TimeStamp)
+
+	unchanged := (ipv4 == "" || ipv4 == host.Ipv4) && (ipv6 == "" || ipv6 == host.Ipv6)
+	refresh := h.ForceRefresh > 0 && log.TimeStamp.Sub(host.LastUpdate) >= h.ForceRefresh
+	if unchanged && !refresh {
+		log.Status = true
+		log.Unchanged = true
+		return h.logUpdate(log, "IP address unchanged, DNS update skipped", "nochg "+log.SentIP)
+	}
+
+	// Add/update DNS records
+	for _, record := range []struct {
+		addrType string
+		ip       string
+		current  string
+	}{{"A", ipv4, host.Ipv4}, {"AAAA", ipv6, host.Ipv6}} {
+		if record.ip == "" || (record.ip == record.current && !refresh) {
+			continue
+		}
+
+		if err := h.DNS.UpdateRecord(host.Hostname, record.ip, record.addrType, host.Domain, host.Ttl, h.AllowWildcard); err != nil {
+			message := fmt.Sprintf("DNS error: %v", err)
+			l.Error(message)
+			h.dispatchUpdateFailed(host, log, message)
+			return h.logUpdate(log, message, "dnserr")
 		}
-		return c.String(http.StatusBadRequest, "dnserr\n")
 	}
 
 	// Update DB host entry
-	log.Host.Ip = log.SentIP
-	log.Host.LastUpdate = log.TimeStamp
+	oldIP := hostIPs(host)
+	if ipv4 != "" {
+		host.SetIPv4(ipv4, log.TimeStamp)
+	}
+	if ipv6 != "" {
+		host.SetIPv6(ipv6, log.TimeStamp)
+	}
+	host.LastUpdate = log.TimeStamp
+
+	if err := h.DB.Save(host).Error; err != nil {
+		l.Error(err)
+		message := fmt.Sprintf("Database error: %v", err)
+		h.dispatchUpdateFailed(host, log, message)
+		return h.logUpdate(log, message, "911")
+	}
+	log.Host = *host
 
-	if err = h.DB.Save(log.Host).Error; err != nil {
-		return c.JSON(http.StatusBadRequest, "badrequest\n")
+	if !unchanged {
+		event := hostEvent(model.EventIPChange, host)
+		event.OldIP = oldIP
+		event.NewIP = hostIPs(host)
+		event.CallerIP = log.CallerIP
+		event.Timestamp = log.TimeStamp
+		h.webhooks.Dispatch(event)
 	}
 
 	log.Status = true
-	log.Message = "No errors occurred"
-	if err = h.CreateLogEntry(log); err != nil {
+	if unchanged {
+		return h.logUpdate(log, "IP address unchanged, DNS records refreshed", "good "+log.SentIP)
+	}
+
+	return h.logUpdate(log, "No errors occurred", "good "+log.SentIP)
+}
+
+// logUpdate stores the log entry of an update with message and returns result.
+func (h *Handler) logUpdate(log *model.Log, message string, result string) string {
+	log.Message = message
+	if err := h.CreateLogEntry(log); err != nil {
 		l.Error(err)
 	}
 
-	return c.String(http.StatusOK, "good\n")
+	return result
+}
+
+// callerIP returns the address of the update client, see nswrapper.GetCallerIP.
+// The remote address is returned as is, if it can't be parsed.
+func (h *Handler) callerIP(c echo.Context) string {
+	ip, err := nswrapper.GetCallerIP(c.Request(), h.TrustedProxies, h.ForwardedHeader)
+	if err != nil {
+		return c.Request().RemoteAddr
+	}
+
+	return ip
+}
+
+// containsHost reports whether the host with id is one of hosts.
+func containsHost(hosts []model.Host, id uint) bool {
+	for _, host := range hosts {
+		if host.ID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitIPs returns the first IPv4 and the first IPv6 address of the comma separated lists.
+// Invalid entries are skipped.
+func splitIPs(lists ...string) (ipv4 string, ipv6 string) {
+	for _, list := range lists {
+		for _, ip := range strings.Split(list, ",") {
+			ip = strings.TrimSpace(ip)
+			switch nswrapper.GetIPType(ip) {
+			case "A":
+				if ipv4 == "" {
+					ipv4 = ip
+				}
+			case "AAAA":
+				if ipv6 == "" {
+					ipv6 = ip
+				}
+			}
+		}
+	}
+
+	return ipv4, ipv6
+}
+
+// createHost adds a validated host entry to the database
+// and adds the A and AAAA entries of the set addresses to the DNS server.
+func (h *Handler) createHost(host *model.Host) (err error) {
+	if err = h.checkUniqueHostname(host.Hostname, host.Domain); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	host.LastUpdate = now
+	if host.Ipv4 != "" {
+		host.Ipv4LastUpdate = now
+	}
+	if host.Ipv6 != "" {
+		host.Ipv6LastUpdate = now
+	}
+
+	if err = h.DB.Create(host).Error; err != nil {
+		return err
+	}
+
+	if err = h.updateHostRecords(host, false); err != nil {
+		return err
+	}
+
+	event := hostEvent(model.EventHostCreated, host)
+	event.NewIP = hostIPs(host)
+	h.webhooks.Dispatch(event)
+
+	return nil
+}
+
+// saveHost saves a validated host entry to the database
+// and updates the DNS entry if updateRecord is set.
+func (h *Handler) saveHost(host *model.Host, updateRecord bool) (err error) {
+	if err = h.DB.Save(host).Error; err != nil {
+		return err
+	}
+
+	// If an ip or the ttl changed update dns entries
+	if updateRecord {
+		return h.updateHostRecords(host, true)
+	}
+
+	return nil
+}
+
+// updateHostRecords pushes the A and AAAA record of host to the DNS server.
+// If removeUnset is set, the record of an unset address is removed.
+func (h *Handler) updateHostRecords(host *model.Host, removeUnset bool) error {
+	for _, record := range []struct {
+		addrType string
+		ip       string
+	}{{"A", host.Ipv4}, {"AAAA", host.Ipv6}} {
+		if record.ip != "" {
+			if err := h.DNS.UpdateRecord(host.Hostname, record.ip, record.addrType, host.Domain, host.Ttl, h.AllowWildcard); err != nil {
+				return err
+			}
+		} else if removeUnset {
+			if err := h.DNS.DeleteRecordType(host.Hostname, record.addrType, host.Domain, h.AllowWildcard); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// deleteHost deletes a host entry together with its logs, cnames and records
+// from the database and the DNS server.
+func (h *Handler) deleteHost(host *model.Host) (err error) {
+	// records below the host name have to be removed from the DNS server one by one
+	names := []string{}
+	if err = h.DB.Model(&model.Record{}).Where("host_id = ? AND name <> ?", host.ID, "").Distinct().Pluck("name", &names).Error; err != nil {
+		return err
+	}
+
+	// dependent rows are deleted first, databases enforcing foreign keys would refuse the host otherwise
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("host_id = ?", host.ID).Delete(&model.Record{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("host_id = ?", host.ID).Delete(&model.Log{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Unscoped().Where("target_id = ?", host.ID).Delete(&model.CName{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(host).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if err = h.DNS.DeleteRecord(host.Hostname, host.Domain, h.AllowWildcard); err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if err = h.DNS.DeleteRecord(name+"."+host.Hostname, host.Domain, false); err != nil {
+			return err
+		}
+	}
+
+	// the webhooks of the host receive the event before they are deleted
+	event := hostEvent(model.EventHostDeleted, host)
+	event.OldIP = hostIPs(host)
+	h.webhooks.Dispatch(event)
+
+	return h.DB.Where("host_id = ?", host.ID).Delete(&model.Webhook{}).Error
 }
 
 func (h *Handler) checkUniqueHostname(hostname, domain string) error {
@@ -310,7 +524,7 @@ func (h *Handler) checkUniqueHostname(hostname, domain string) error {
 	}
 
 	if len(*hosts) > 0 {
-		return fmt.Errorf("hostname already exists")
+		return errHostnameExists
 	}
 
 	cnames := new([]model.CName)
@@ -320,7 +534,7 @@ func (h *Handler) checkUniqueHostname(hostname, domain string) error {
 
 	for _, cname := range *cnames {
 		if cname.Target.Domain == domain {
-			return fmt.Errorf("hostname already exists")
+			return errHostnameExists
 		}
 	}
 
@@ -1,10 +1,8 @@
 package handler
 
 import (
-	"log"
 	"net/http"
 	"strconv"
-	"time"
 
 	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
 	"github.com/labstack/echo/v4"
@@ -21,12 +19,12 @@ func (h *Handler) CreateLogEntry(log *model.Log) (err error) {
 
 // ShowLogs fetches all log entries from all hosts and renders them to the website.
 func (h *Handler) ShowLogs(c echo.Context) (err error) {
-	if !h.AuthAdmin {
+	if GetPrincipal(c) == nil {
 		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
 	}
 
 	logs := new([]model.Log)
-	if err = h.DB.Preload("Host").Limit(30).Order("created_at desc").Find(logs).Error; err != nil {
+	if err = h.DB.Scopes(h.tenantLogs(c)).Preload("Host").Limit(30).Order("created_at desc").Find(logs).Error; err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
@@ -38,7 +36,7 @@ func (h *Handler) ShowLogs(c echo.Context) (err error) {
 
 // ShowHostLogs fetches all log entries of a specific host by "id" and renders them to the website.
 func (h *Handler) ShowHostLogs(c echo.Context) (err error) {
-	if !h.AuthAdmin {
+	if GetPrincipal(c) == nil {
 		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
 	}
 
@@ -48,7 +46,7 @@ func (h *Handler) ShowHostLogs(c echo.Context) (err error) {
 	}
 
 	logs := new([]model.Log)
-	if err = h.DB.Preload("Host").Where(&model.Log{HostID: uint(id)}).Order("created_at desc").Limit(30).Find(logs).Error; err != nil {
+	if err = h.DB.Scopes(h.tenantLogs(c)).Preload("Host").Where(&model.Log{HostID: uint(id)}).Order("created_at desc").Limit(30).Find(logs).Error; err != nil {
 		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
 	}
 
@@ -57,10 +55,3 @@ func (h *Handler) ShowHostLogs(c echo.Context) (err error) {
 		"title": h.Title,
 	})
 }
-
-func (h *Handler) ClearLogs() {
-	var clearInterval = strconv.FormatUint(h.ClearInterval, 10) + " day"
-	h.DB.Exec("DELETE FROM LOGS WHERE created_at < datetime('now', '-" + clearInterval + "');REINDEX LOGS;")
-	h.LastClearedLogs = time.Now()
-	log.Print("logs cleared")
-}
@@ -0,0 +1,273 @@
+package handler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/labstack/echo/v4"
+	l "github.com/labstack/gommon/log"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcStateCookie = "ddns_oidc_state"
+	oidcLoginTTL    = 10 * time.Minute
+)
+
+// OIDCConfig configures the OpenID Connect login of the admin ui.
+type OIDCConfig struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	// GroupsClaim is the claim of the ID token listing the groups of the user.
+	GroupsClaim string
+	// OwnerGroups, OperatorGroups and ViewerGroups map groups to admin roles.
+	OwnerGroups    []string
+	OperatorGroups []string
+	ViewerGroups   []string
+	SessionTTL     time.Duration
+}
+
+// oidcLogin is a pending authorization code flow.
+type oidcLogin struct {
+	nonce    string
+	verifier string
+	expires  time.Time
+}
+
+// oidcClient runs the authorization code flow with PKCE against the configured issuer.
+type oidcClient struct {
+	config        OIDCConfig
+	oauth2        oauth2.Config
+	verifier      *oidc.IDTokenVerifier
+	endSessionURL string
+
+	mu     sync.Mutex
+	logins map[string]*oidcLogin
+}
+
+// newOIDCClient discovers the issuer and creates the OIDC client.
+func newOIDCClient(ctx context.Context, config OIDCConfig) (*oidcClient, error) {
+	provider, err := oidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %w", err)
+	}
+
+	claims := &struct {
+		EndSessionEndpoint string `json:"end_session_endpoint"`
+	}{}
+	if err = provider.Claims(claims); err != nil {
+		return nil, err
+	}
+
+	return &oidcClient{
+		config: config,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       []string{oidc.ScopeOpenID, "profile", "email"},
+		},
+		verifier:      provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+		endSessionURL: claims.EndSessionEndpoint,
+		logins:        map[string]*oidcLogin{},
+	}, nil
+}
+
+// role maps the groups of a user to the highest admin role they grant.
+func (o *oidcClient) role(groups []string) string {
+	for _, mapping := range []struct {
+		role   string
+		groups []string
+	}{
+		{model.RoleOwner, o.config.OwnerGroups},
+		{model.RoleOperator, o.config.OperatorGroups},
+		{model.RoleViewer, o.config.ViewerGroups},
+	} {
+		for _, group := range groups {
+			for _, g := range mapping.groups {
+				if g == group {
+					return mapping.role
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// logoutURL returns the end session url of the issuer, which redirects back to the start page.
+func (o *oidcClient) logoutURL(idToken string) string {
+	params := url.Values{}
+	params.Set("client_id", o.config.ClientID)
+	if idToken != "" {
+		params.Set("id_token_hint", idToken)
+	}
+	if redirect, err := url.Parse(o.config.RedirectURL); err == nil {
+		params.Set("post_logout_redirect_uri", redirect.Scheme+"://"+redirect.Host+"/")
+	}
+
+	return o.endSessionURL + "?" + params.Encode()
+}
+
+// startLogin stores a new pending login and returns its state.
+func (o *oidcClient) startLogin() (state string, login *oidcLogin) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := time.Now()
+	for s, pending := range o.logins {
+		if now.After(pending.expires) {
+			delete(o.logins, s)
+		}
+	}
+
+	state = randomString()
+	login = &oidcLogin{nonce: randomString(), verifier: oauth2.GenerateVerifier(), expires: now.Add(oidcLoginTTL)}
+	o.logins[state] = login
+
+	return state, login
+}
+
+// finishLogin removes and returns the pending login of state.
+func (o *oidcClient) finishLogin(state string) *oidcLogin {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	login, ok := o.logins[state]
+	if !ok || time.Now().After(login.expires) {
+		return nil
+	}
+	delete(o.logins, state)
+
+	return login
+}
+
+func randomString() string {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(random)
+}
+
+// OIDCEnabled tells if the admin ui uses the OpenID Connect login.
+func (h *Handler) OIDCEnabled() bool {
+	return h.oidc != nil
+}
+
+// OIDCLogin redirects to the issuer to start the authorization code flow.
+func (h *Handler) OIDCLogin(c echo.Context) error {
+	state, login := h.oidc.startLogin()
+
+	c.SetCookie(&http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/auth",
+		MaxAge:   int(oidcLoginTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return c.Redirect(http.StatusFound, h.oidc.oauth2.AuthCodeURL(state, oidc.Nonce(login.nonce), oauth2.S256ChallengeOption(login.verifier)))
+}
+
+// OIDCCallback finishes the authorization code flow,
+// maps the groups of the user to an admin role and starts a session.
+func (h *Handler) OIDCCallback(c echo.Context) error {
+	if errParam := c.QueryParam("error"); errParam != "" {
+		return c.JSON(http.StatusUnauthorized, &Error{fmt.Sprintf("login failed: %s %s", errParam, c.QueryParam("error_description"))})
+	}
+
+	state := c.QueryParam("state")
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		return c.JSON(http.StatusBadRequest, &Error{"invalid login state"})
+	}
+
+	login := h.oidc.finishLogin(state)
+	if login == nil {
+		return c.JSON(http.StatusBadRequest, &Error{"login expired, please try again"})
+	}
+
+	ctx := c.Request().Context()
+	token, err := h.oidc.oauth2.Exchange(ctx, c.QueryParam("code"), oauth2.VerifierOption(login.verifier))
+	if err != nil {
+		l.Error("Error: ", err)
+		return c.JSON(http.StatusUnauthorized, &Error{"login failed"})
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return c.JSON(http.StatusUnauthorized, &Error{"login failed: no id token"})
+	}
+
+	idToken, err := h.oidc.verifier.Verify(ctx, rawIDToken)
+	if err != nil || idToken.Nonce != login.nonce {
+		l.Error("Error: ", err)
+		return c.JSON(http.StatusUnauthorized, &Error{"login failed: invalid id token"})
+	}
+
+	claims := map[string]interface{}{}
+	if err = idToken.Claims(&claims); err != nil {
+		return c.JSON(http.StatusUnauthorized, &Error{err.Error()})
+	}
+
+	username := claimString(claims, "preferred_username", "email", "sub")
+	role := h.oidc.role(claimStrings(claims, h.oidc.config.GroupsClaim))
+	if role == "" {
+		l.Warn("OIDC user without admin group: ", username)
+		return c.JSON(http.StatusForbidden, &Error{UNAUTHORIZED})
+	}
+
+	session := &model.Session{UserName: username, Role: role, IDToken: rawIDToken}
+	if err = h.createSession(c, session); err != nil {
+		return c.JSON(http.StatusInternalServerError, &Error{err.Error()})
+	}
+
+	setPrincipal(c, &Principal{Name: username, Role: role})
+	h.audit(c, "login", username+" ("+role+")")
+
+	return c.Redirect(http.StatusFound, "/admin/")
+}
+
+// claimString returns the first non-empty string claim of names.
+func claimString(claims map[string]interface{}, names ...string) string {
+	for _, name := range names {
+		if value, ok := claims[name].(string); ok && value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// claimStrings returns a claim which is either a list of strings or a single string.
+func claimStrings(claims map[string]interface{}, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := []string{}
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+
+	return []string{}
+}
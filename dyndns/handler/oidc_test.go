@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/echo/v4"
+)
+
+// fakeIssuer is a minimal OpenID Connect provider signing ID tokens with an RSA key.
+type fakeIssuer struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	nonce  string
+	groups []string
+	// challenge is the PKCE code challenge of the authorization request.
+	challenge string
+}
+
+func newFakeIssuer(t *testing.T) *fakeIssuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	f := &fakeIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                f.URL,
+			"authorization_endpoint":                f.URL + "/auth",
+			"token_endpoint":                        f.URL + "/token",
+			"jwks_uri":                              f.URL + "/keys",
+			"end_session_endpoint":                  f.URL + "/logout",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "alg": "RS256", "use": "sig", "kid": "test",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+		if base64.RawURLEncoding.EncodeToString(sum[:]) != f.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     f.idToken(t),
+		})
+	})
+	f.Server = httptest.NewServer(mux)
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+func (f *fakeIssuer) idToken(t *testing.T) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test", "typ": "JWT"})
+	payload, _ := json.Marshal(map[string]interface{}{
+		"iss":                f.URL,
+		"aud":                "ddns",
+		"sub":                "1234",
+		"preferred_username": "alice",
+		"groups":             f.groups,
+		"nonce":              f.nonce,
+		"iat":                time.Now().Unix(),
+		"exp":                time.Now().Add(time.Hour).Unix(),
+	})
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	sum := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// oidcLoginFlow runs login and callback and returns the response of the callback.
+func oidcLoginFlow(t *testing.T, h *Handler, issuer *fakeIssuer) *httptest.ResponseRecorder {
+	e := newTestEcho()
+
+	rec := httptest.NewRecorder()
+	h.OIDCLogin(e.NewContext(httptest.NewRequest(http.MethodGet, "/auth/login", nil), rec))
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil || !strings.HasPrefix(location.String(), issuer.URL+"/auth") {
+		t.Fatalf("Expected redirect to the issuer but got %q", rec.Header().Get("Location"))
+	}
+	if location.Query().Get("code_challenge_method") != "S256" {
+		t.Fatalf("Expected PKCE challenge but got %s", location)
+	}
+	issuer.nonce = location.Query().Get("nonce")
+	issuer.challenge = location.Query().Get("code_challenge")
+
+	req := httptest.NewRequest(http.MethodGet, "/auth/callback?code=abc&state="+location.Query().Get("state"), nil)
+	for _, cookie := range rec.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	rec = httptest.NewRecorder()
+	h.OIDCCallback(e.NewContext(req, rec))
+
+	return rec
+}
+
+func newOIDCTestHandler(t *testing.T, issuer *fakeIssuer) *Handler {
+	h, _ := newTestHandler(t)
+	h.Config.OIDC = OIDCConfig{
+		Issuer:         issuer.URL,
+		ClientID:       "ddns",
+		RedirectURL:    "http://dyndns.example.com/auth/callback",
+		GroupsClaim:    "groups",
+		OperatorGroups: []string{"dns-admins"},
+		SessionTTL:     time.Hour,
+	}
+
+	var err error
+	if h.oidc, err = newOIDCClient(context.Background(), h.Config.OIDC); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	return h
+}
+
+func TestOIDCLoginToCreateSessionWithMappedRole(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	issuer.groups = []string{"staff", "dns-admins"}
+	h := newOIDCTestHandler(t, issuer)
+
+	rec := oidcLoginFlow(t, h, issuer)
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/admin/" {
+		t.Fatalf("Expected redirect to /admin/ but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var session *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == sessionCookie {
+			session = cookie
+		}
+	}
+	if session == nil || !session.HttpOnly {
+		t.Fatalf("Expected http only session cookie but got %v", rec.Result().Cookies())
+	}
+
+	// the session authenticates following requests
+	e := newTestEcho()
+	req := httptest.NewRequest(http.MethodGet, "/admin/", nil)
+	req.AddCookie(session)
+	c := e.NewContext(req, httptest.NewRecorder())
+	h.SessionAuth(func(c echo.Context) error { return nil })(c)
+	if principal := GetPrincipal(c); principal == nil || principal.Name != "alice" || principal.Role != model.RoleOperator {
+		t.Fatalf("Expected operator alice but got %+v", principal)
+	}
+
+	// other sites can't use the session for changing requests
+	for header, value := range map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example.com"} {
+		req := httptest.NewRequest(http.MethodDelete, "/admin/hosts/delete/1", nil)
+		req.Header.Set(header, value)
+		req.AddCookie(session)
+		c := e.NewContext(req, httptest.NewRecorder())
+		h.SessionAuth(func(c echo.Context) error { return nil })(c)
+		if principal := GetPrincipal(c); principal != nil {
+			t.Fatalf("Expected session to be ignored with %s: %s but got %+v", header, value, principal)
+		}
+	}
+
+	// logout ends the session at the issuer as well
+	rec = httptest.NewRecorder()
+	h.Logout(e.NewContext(req, rec))
+	if !strings.HasPrefix(rec.Header().Get("Location"), issuer.URL+"/logout") {
+		t.Fatalf("Expected redirect to the end session endpoint but got %q", rec.Header().Get("Location"))
+	}
+	if h.findSession(e.NewContext(req, httptest.NewRecorder())) != nil {
+		t.Fatalf("Expected session to be deleted on logout")
+	}
+}
+
+func TestOIDCLoginToRejectUserWithoutAdminGroup(t *testing.T) {
+	issuer := newFakeIssuer(t)
+	issuer.groups = []string{"staff"}
+	h := newOIDCTestHandler(t, issuer)
+
+	if rec := oidcLoginFlow(t, h, issuer); rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403 but got %d: %s", rec.Code, rec.Body.String())
+	}
+}
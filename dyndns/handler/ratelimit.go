@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/metrics"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/ratelimit"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/gommon/log"
+)
+
+// defaultAuthLockout locks out a source after 10 failed update logins for 15 minutes.
+const defaultAuthLockout = "10/15m"
+
+// initRateLimits creates the limiters of the update endpoints.
+func (h *Handler) initRateLimits() (err error) {
+	if h.hostLimit, err = parseLimit("DDNS_RATE_LIMIT_HOST", ""); err != nil {
+		return err
+	}
+
+	if h.sourceLimit, err = parseLimit("DDNS_RATE_LIMIT_IP", ""); err != nil {
+		return err
+	}
+
+	if h.authLockout, err = parseLimit("DDNS_AUTH_LOCKOUT", defaultAuthLockout); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// parseLimit creates a limiter from the rate of the environment variable env, or def if it is unset.
+func parseLimit(env string, def string) (*ratelimit.Limiter, error) {
+	rate, ok := os.LookupEnv(env)
+	if !ok {
+		rate = def
+	}
+
+	limiter, err := ratelimit.Parse(rate)
+	if err != nil {
+		return nil, fmt.Errorf("environment variable %s is invalid: %w", env, err)
+	}
+
+	if limiter != nil {
+		log.Info(env, " set: ", rate)
+	}
+
+	return limiter, nil
+}
+
+// UpdateLimit answers update requests with "abuse",
+// if the source is locked out after failed logins or exceeds its rate limit.
+// The source is the peer address, forwarded headers only count if the peer is a trusted proxy.
+func (h *Handler) UpdateLimit(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ip := h.callerIP(c)
+		if h.authLockout.Exceeded(ip) {
+			log.Warn("Update source locked out after failed logins: ", ip)
+			metrics.CountUpdate("abuse")
+			return c.String(http.StatusOK, "abuse\n")
+		}
+
+		if !h.sourceLimit.Allow(ip) {
+			log.Warn("Update source exceeded the rate limit: ", ip)
+			metrics.CountUpdate("abuse")
+			return c.String(http.StatusOK, "abuse\n")
+		}
+
+		return next(c)
+	}
+}
+
+// ChallengeLimit answers ACME challenge requests with 429,
+// if the source is locked out after failed logins or exceeds its rate limit.
+func (h *Handler) ChallengeLimit(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ip := h.callerIP(c)
+		if h.authLockout.Exceeded(ip) || !h.sourceLimit.Allow(ip) {
+			log.Warn("Challenge source locked out or exceeded the rate limit: ", ip)
+			return c.JSON(http.StatusTooManyRequests, &Error{"too many requests"})
+		}
+
+		return next(c)
+	}
+}
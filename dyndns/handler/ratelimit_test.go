@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/nswrapper"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/ratelimit"
+)
+
+func TestUpdateLimitToLockOutAfterFailedLogins(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.authLockout = ratelimit.New(2, time.Minute)
+	h.DB.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ttl: 60, UserName: "bloguser", Password: "blogpassword"})
+
+	e := newTestEcho()
+	e.GET("/update", h.UpdateIP, h.UpdateLimit, h.UpdateAuth)
+
+	update := func(password string, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/update?hostname=blog.dyndns.example.com&myip=1.2.3.4", nil)
+		req.SetBasicAuth("bloguser", password)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := update("wrongpassword", "192.0.2.1:1234"); rec.Code != http.StatusUnauthorized || rec.Body.String() != "badauth\n" {
+			t.Fatalf("Expected status 401 with badauth but got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	if rec := update("blogpassword", "192.0.2.1:1234"); rec.Body.String() != "abuse\n" {
+		t.Fatalf("Expected abuse but got %s", rec.Body.String())
+	}
+
+	if rec := update("blogpassword", "192.0.2.2:1234"); rec.Body.String() != "good 1.2.3.4\n" {
+		t.Fatalf("Expected other sources not to be locked out but got %s", rec.Body.String())
+	}
+}
+
+func TestUpdateLimitToIgnoreSpoofedForwardedHeaders(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.authLockout = ratelimit.New(2, time.Minute)
+	h.TrustedProxies, _ = nswrapper.ParseTrustedProxies([]string{"10.0.0.2"})
+	h.ForwardedHeader = nswrapper.DefaultForwardedHeader
+	h.DB.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ttl: 60, UserName: "bloguser", Password: "blogpassword"})
+
+	e := newTestEcho()
+	e.GET("/update", h.UpdateIP, h.UpdateLimit, h.UpdateAuth)
+
+	update := func(password string, remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/update?hostname=blog.dyndns.example.com&myip=1.2.3.4", nil)
+		req.SetBasicAuth("bloguser", password)
+		req.RemoteAddr = remoteAddr
+		for header, value := range headers {
+			req.Header.Set(header, value)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	// a client without proxy and a client behind the trusted proxy
+	for i := 0; i < 2; i++ {
+		update("wrongpassword", "192.0.2.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.1"})
+		update("wrongpassword", "10.0.0.2:1234", map[string]string{"X-Forwarded-For": "192.0.2.7"})
+	}
+
+	for _, test := range []struct {
+		remoteAddr string
+		headers    map[string]string
+	}{
+		{"192.0.2.1:1234", map[string]string{"X-Forwarded-For": "198.51.100.2"}},
+		{"192.0.2.1:1234", map[string]string{"Forwarded": "for=198.51.100.2", "X-Real-Ip": "198.51.100.2"}},
+		{"10.0.0.2:1234", map[string]string{"X-Forwarded-For": "192.0.2.7", "Forwarded": "for=198.51.100.2"}},
+		{"10.0.0.2:1234", map[string]string{"X-Forwarded-For": "192.0.2.7", "X-Real-Ip": "198.51.100.2"}},
+	} {
+		if rec := update("blogpassword", test.remoteAddr, test.headers); rec.Body.String() != "abuse\n" {
+			t.Fatalf("Expected %v from %s to stay locked out but got %s", test.headers, test.remoteAddr, rec.Body.String())
+		}
+	}
+}
+
+func TestUpdateIPToAnswerAbuseOverHostLimit(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.hostLimit = ratelimit.New(1, time.Minute)
+	h.DB.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ttl: 60, UserName: "bloguser", Password: "blogpassword"})
+
+	if body := updateRequest(t, h, "bloguser", "blogpassword", "hostname=blog.dyndns.example.com&myip=1.2.3.4"); body != "good 1.2.3.4\n" {
+		t.Fatalf("Expected good but got %s", body)
+	}
+
+	if body := updateRequest(t, h, "bloguser", "blogpassword", "hostname=blog.dyndns.example.com&myip=1.2.3.4"); body != "abuse\n" {
+		t.Fatalf("Expected abuse but got %s", body)
+	}
+}
@@ -0,0 +1,456 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/nswrapper"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type recordResponse struct {
+	ID       uint   `json:"id"`
+	HostID   uint   `json:"host_id"`
+	Host     string `json:"host"`
+	Type     string `json:"type"`
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Priority int    `json:"priority,omitempty"`
+	Weight   int    `json:"weight,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	Flag     int    `json:"flag,omitempty"`
+	Tag      string `json:"tag,omitempty"`
+	Ttl      int    `json:"ttl"`
+	// Data is the record data as published in the zone.
+	Data      string    `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// recordRequest is the body of POST, PUT and PATCH requests on records.
+// Fields missing in a PATCH request are left untouched, the host can't be changed.
+type recordRequest struct {
+	HostID   *uint   `json:"host_id"`
+	Type     *string `json:"type"`
+	Name     *string `json:"name"`
+	Value    *string `json:"value"`
+	Priority *int    `json:"priority"`
+	Weight   *int    `json:"weight"`
+	Port     *int    `json:"port"`
+	Flag     *int    `json:"flag"`
+	Tag      *string `json:"tag"`
+	Ttl      *int    `json:"ttl"`
+}
+
+func newRecordResponse(record *model.Record) *recordResponse {
+	return &recordResponse{
+		ID:        record.ID,
+		HostID:    record.HostID,
+		Host:      record.Host.Hostname + "." + record.Host.Domain,
+		Type:      record.Type,
+		Name:      record.Name,
+		Value:     record.Value,
+		Priority:  record.Priority,
+		Weight:    record.Weight,
+		Port:      record.Port,
+		Flag:      record.Flag,
+		Tag:       record.Tag,
+		Ttl:       record.Ttl,
+		Data:      recordData(record),
+		CreatedAt: record.CreatedAt,
+		UpdatedAt: record.UpdatedAt,
+	}
+}
+
+// ListHostRecords fetches all TXT, MX, SRV and CAA records from database and lists them on the website.
+func (h *Handler) ListHostRecords(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	records := new([]model.Record)
+	if err = h.DB.Scopes(h.tenantRecords(c)).Preload("Host").Order("host_id, type, name").Find(records).Error; err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	return c.Render(http.StatusOK, "listrecords", echo.Map{
+		"records": records,
+		"title":   h.Title,
+	})
+}
+
+// AddHostRecord just renders the "add record" website.
+// Therefore all host entries from the database are being fetched.
+func (h *Handler) AddHostRecord(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	hosts := new([]model.Host)
+	if err = h.DB.Scopes(tenantHosts(c)).Find(hosts).Error; err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	return c.Render(http.StatusOK, "addrecord", echo.Map{
+		"hosts": hosts,
+		"title": h.Title,
+	})
+}
+
+// CreateHostRecord validates the record data from the "add record" website,
+// adds the record to the database and publishes it on the DNS server.
+func (h *Handler) CreateHostRecord(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	record := &model.Record{}
+	if err = c.Bind(record); err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	hostID, err := strconv.Atoi(c.FormValue("host_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	host := &model.Host{}
+	if err = h.DB.Scopes(tenantHosts(c)).First(host, hostID).Error; err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	record.Host = *host
+	record.HostID = host.ID
+
+	if err = h.validateRecord(c, record); err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	if err = h.createRecord(record); err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	h.audit(c, "create record", record.Type+" "+record.Owner()+"."+record.Host.Domain)
+
+	return c.JSON(http.StatusOK, newRecordResponse(record))
+}
+
+// APIListHostRecords returns a page of records, optionally filtered by "host_id" and "type".
+func (h *Handler) APIListHostRecords(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	query := h.DB.Model(&model.Record{}).Scopes(h.tenantRecords(c)).Where(&model.Record{Type: c.QueryParam("type")})
+	if param := c.QueryParam("host_id"); param != "" {
+		hostID, err := strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+		}
+		query = query.Where(&model.Record{HostID: uint(hostID)})
+	}
+
+	query, page, err := paginate(c, query)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	records := new([]model.Record)
+	if err = query.Preload("Host").Order("id").Find(records).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	items := []*recordResponse{}
+	for i := range *records {
+		items = append(items, newRecordResponse(&(*records)[i]))
+	}
+	page.Items = items
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// APIGetHostRecord returns a single record by "id".
+func (h *Handler) APIGetHostRecord(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	record, err := h.apiFindRecord(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, newRecordResponse(record))
+}
+
+// APICreateHostRecord creates a record and publishes it on the DNS server.
+func (h *Handler) APICreateHostRecord(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	req := &recordRequest{}
+	if err = c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	record := &model.Record{}
+	if err = h.applyRecordRequest(c, req, record, true); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.validateRecord(c, record); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.createRecord(record); err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "create record", record.Type+" "+record.Owner()+"."+record.Host.Domain)
+
+	return c.JSON(http.StatusCreated, newRecordResponse(record))
+}
+
+// APIReplaceHostRecord replaces all fields of a record by "id" (PUT).
+func (h *Handler) APIReplaceHostRecord(c echo.Context) (err error) {
+	return h.apiUpdateRecord(c, true)
+}
+
+// APIPatchHostRecord updates the given fields of a record by "id" (PATCH).
+func (h *Handler) APIPatchHostRecord(c echo.Context) (err error) {
+	return h.apiUpdateRecord(c, false)
+}
+
+func (h *Handler) apiUpdateRecord(c echo.Context, replace bool) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	record, err := h.apiFindRecord(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+	old := *record
+
+	req := &recordRequest{}
+	if err = c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	if err = h.applyRecordRequest(c, req, record, replace); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.validateRecord(c, record); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.saveRecord(record, &old); err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "update record", record.Type+" "+record.Owner()+"."+record.Host.Domain)
+
+	return c.JSON(http.StatusOK, newRecordResponse(record))
+}
+
+// APIDeleteHostRecord deletes a record by "id" and removes it from the DNS server.
+func (h *Handler) APIDeleteHostRecord(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	record, err := h.apiFindRecord(c)
+	if err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.deleteRecord(record); err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "delete record", record.Type+" "+record.Owner()+"."+record.Host.Domain)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// apiFindRecord fetches the record referenced by the "id" path parameter.
+func (h *Handler) apiFindRecord(c echo.Context) (*model.Record, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidRequest, err)
+	}
+
+	record := &model.Record{}
+	if err = h.DB.Scopes(h.tenantRecords(c)).Preload("Host").First(record, id).Error; err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// applyRecordRequest copies the request fields to record and resolves its host.
+// If replace is set type, value and ttl have to be present, omitted optional fields are reset.
+func (h *Handler) applyRecordRequest(c echo.Context, r *recordRequest, record *model.Record, replace bool) error {
+	if replace && (r.Type == nil || r.Value == nil || r.Ttl == nil) {
+		return fmt.Errorf("%w: type, value and ttl are required", errInvalidRequest)
+	}
+
+	if record.ID == 0 && r.HostID == nil {
+		return fmt.Errorf("%w: host_id is required", errInvalidRequest)
+	}
+
+	if record.ID != 0 && r.HostID != nil && *r.HostID != record.HostID {
+		return fmt.Errorf("%w: host_id can not be changed", errInvalidRequest)
+	}
+
+	if replace {
+		record.Name, record.Priority, record.Weight, record.Port, record.Flag, record.Tag = "", 0, 0, 0, 0, ""
+	}
+
+	if r.Type != nil {
+		record.Type = *r.Type
+	}
+	if r.Name != nil {
+		record.Name = *r.Name
+	}
+	if r.Value != nil {
+		record.Value = *r.Value
+	}
+	if r.Priority != nil {
+		record.Priority = *r.Priority
+	}
+	if r.Weight != nil {
+		record.Weight = *r.Weight
+	}
+	if r.Port != nil {
+		record.Port = *r.Port
+	}
+	if r.Flag != nil {
+		record.Flag = *r.Flag
+	}
+	if r.Tag != nil {
+		record.Tag = *r.Tag
+	}
+	if r.Ttl != nil {
+		record.Ttl = *r.Ttl
+	}
+
+	if record.ID == 0 {
+		host := &model.Host{}
+		if err := h.DB.Scopes(tenantHosts(c)).First(host, *r.HostID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: host %d not found", errInvalidRequest, *r.HostID)
+			}
+
+			return err
+		}
+
+		record.Host = *host
+		record.HostID = host.ID
+	}
+
+	return nil
+}
+
+// validateRecord checks the type specific fields and then the whole record.
+func (h *Handler) validateRecord(c echo.Context, record *model.Record) error {
+	if err := record.Check(); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidRequest, err)
+	}
+
+	return c.Validate(record)
+}
+
+// createRecord adds a validated record to the database
+// and publishes the record set it belongs to on the DNS server.
+func (h *Handler) createRecord(record *model.Record) (err error) {
+	if err = h.checkRecordName(record); err != nil {
+		return err
+	}
+
+	if err = h.DB.Create(record).Error; err != nil {
+		return err
+	}
+
+	return h.updateRecordSet(record)
+}
+
+// saveRecord saves a validated record to the database and updates its record set on the DNS server.
+// The record set of old is updated as well, if the record moved to another name or type.
+func (h *Handler) saveRecord(record *model.Record, old *model.Record) (err error) {
+	if record.Name != old.Name {
+		if err = h.checkRecordName(record); err != nil {
+			return err
+		}
+	}
+
+	if err = h.DB.Save(record).Error; err != nil {
+		return err
+	}
+
+	if record.Name != old.Name || record.Type != old.Type {
+		if err = h.updateRecordSet(old); err != nil {
+			return err
+		}
+	}
+
+	return h.updateRecordSet(record)
+}
+
+// deleteRecord deletes a record from the database and the DNS server.
+func (h *Handler) deleteRecord(record *model.Record) (err error) {
+	if err = h.DB.Unscoped().Delete(record).Error; err != nil {
+		return err
+	}
+
+	return h.updateRecordSet(record)
+}
+
+// updateRecordSet publishes all records sharing name and type with record on the DNS server.
+// The DNS server keeps a single ttl per record set, so the lowest one is used.
+func (h *Handler) updateRecordSet(record *model.Record) error {
+	records := new([]model.Record)
+	if err := h.DB.Where("host_id = ? AND type = ? AND name = ?", record.HostID, record.Type, record.Name).Order("id").Find(records).Error; err != nil {
+		return err
+	}
+
+	targets := []string{}
+	ttl := 0
+	for i := range *records {
+		targets = append(targets, recordData(&(*records)[i]))
+		if ttl == 0 || (*records)[i].Ttl < ttl {
+			ttl = (*records)[i].Ttl
+		}
+	}
+
+	return h.DNS.UpdateRecordSet(record.Owner(), targets, record.Type, record.Host.Domain, ttl)
+}
+
+// checkRecordName makes sure records below a host don't shadow another host or cname.
+func (h *Handler) checkRecordName(record *model.Record) error {
+	if record.Name == "" {
+		return nil
+	}
+
+	return h.checkUniqueHostname(record.Owner(), record.Host.Domain)
+}
+
+// recordData returns the presentation format of the data of record.
+func recordData(record *model.Record) string {
+	return nswrapper.RecordData{
+		Type:     record.Type,
+		Value:    record.Value,
+		Priority: record.Priority,
+		Weight:   record.Weight,
+		Port:     record.Port,
+		Flag:     record.Flag,
+		Tag:      record.Tag,
+	}.String()
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/echo/v4"
+)
+
+func TestAPICreateHostRecordToPublishRecordSet(t *testing.T) {
+	h, backend := newTestHandler(t)
+	e := newTestEcho()
+	serve(e, h.APICreateHost, http.MethodPost, "/api/v1/hosts", testHostBody)
+
+	for _, body := range []string{
+		`{"host_id":1,"type":"MX","value":"mx1.example.com","priority":10,"ttl":3600}`,
+		`{"host_id":1,"type":"MX","value":"mx2.example.com","priority":20,"ttl":300}`,
+	} {
+		rec := serve(e, h.APICreateHostRecord, http.MethodPost, "/api/v1/records", body)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("Expected status 201 but got %d: %s", rec.Code, rec.Body.String())
+		}
+	}
+
+	if backend.updates[len(backend.updates)-1] != "set blog.dyndns.example.com MX 10 mx1.example.com., 20 mx2.example.com." {
+		t.Fatalf("Expected both MX records to be published but got %v", backend.updates)
+	}
+
+	rec := serve(e, h.APICreateHostRecord, http.MethodPost, "/api/v1/records", `{"host_id":1,"type":"SRV","name":"_sip._udp","value":"blog.dyndns.example.com","priority":10,"weight":5,"port":5060,"ttl":3600}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if backend.updates[len(backend.updates)-1] != "set _sip._udp.blog.dyndns.example.com SRV 10 5 5060 blog.dyndns.example.com." {
+		t.Fatalf("Expected SRV record below the host but got %v", backend.updates)
+	}
+}
+
+func TestAPICreateHostRecordToValidateByType(t *testing.T) {
+	h, _ := newTestHandler(t)
+	e := newTestEcho()
+	serve(e, h.APICreateHost, http.MethodPost, "/api/v1/hosts", testHostBody)
+
+	for _, body := range []string{
+		`{"host_id":1,"type":"A","value":"1.2.3.4","ttl":3600}`,
+		`{"host_id":1,"type":"MX","value":"not a domain","ttl":3600}`,
+		`{"host_id":1,"type":"SRV","name":"sip","value":"blog.dyndns.example.com","port":5060,"ttl":3600}`,
+		`{"host_id":1,"type":"SRV","name":"_sip._udp","value":"blog.dyndns.example.com","ttl":3600}`,
+		`{"host_id":1,"type":"CAA","tag":"policy","value":"letsencrypt.org","ttl":3600}`,
+		`{"host_id":1,"type":"CAA","tag":"iodef","value":"admin@example.com","ttl":3600}`,
+		`{"host_id":1,"type":"TXT","value":"line\nbreak","ttl":3600}`,
+		`{"host_id":1,"type":"CAA","tag":"issue","value":"letsencrypt.org\nupdate delete dyndns.example.com. A\n","ttl":3600}`,
+		`{"host_id":1,"type":"CAA","tag":"iodef","value":"mailto:admin@example.com\nsend","ttl":3600}`,
+		`{"host_id":1,"type":"TXT","value":"text","ttl":3600,"name":"bad name"}`,
+		`{"host_id":7,"type":"TXT","value":"text","ttl":3600}`,
+	} {
+		rec := serve(e, h.APICreateHostRecord, http.MethodPost, "/api/v1/records", body)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("Expected status 400 for %s but got %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := serve(e, h.APICreateHostRecord, http.MethodPost, "/api/v1/records", `{"host_id":1,"type":"CAA","tag":"issue","value":"letsencrypt.org","priority":10,"ttl":3600}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	record := &model.Record{}
+	h.DB.First(record)
+	if record.Priority != 0 {
+		t.Fatalf("Expected unused priority to be reset but got %d", record.Priority)
+	}
+}
+
+func TestAPIPatchHostRecordToMoveRecordSet(t *testing.T) {
+	h, backend := newTestHandler(t)
+	e := newTestEcho()
+	serve(e, h.APICreateHost, http.MethodPost, "/api/v1/hosts", testHostBody)
+	serve(e, h.APICreateHostRecord, http.MethodPost, "/api/v1/records", `{"host_id":1,"type":"TXT","value":"verification","ttl":3600}`)
+
+	rec := serve(e, h.APIPatchHostRecord, http.MethodPatch, "/api/v1/records/1", `{"name":"_github"}`, "id", "1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	updates := backend.updates[len(backend.updates)-2:]
+	if updates[0] != "set blog.dyndns.example.com TXT " || updates[1] != `set _github.blog.dyndns.example.com TXT "verification"` {
+		t.Fatalf("Expected the record to move from the host to _github but got %v", updates)
+	}
+
+	rec = serve(e, h.APIDeleteHostRecord, http.MethodDelete, "/api/v1/records/1", "", "id", "1")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 but got %d", rec.Code)
+	}
+
+	if backend.updates[len(backend.updates)-1] != "set _github.blog.dyndns.example.com TXT " {
+		t.Fatalf("Expected the record set to be emptied but got %v", backend.updates)
+	}
+}
+
+func TestDeleteHostToDeleteRecords(t *testing.T) {
+	h, backend := newTestHandler(t)
+	e := newTestEcho()
+	serve(e, h.APICreateHost, http.MethodPost, "/api/v1/hosts", testHostBody)
+	serve(e, h.APICreateHostRecord, http.MethodPost, "/api/v1/records", `{"host_id":1,"type":"TXT","name":"_dmarc","value":"v=DMARC1; p=none","ttl":3600}`)
+
+	rec := serve(e, h.APIDeleteHost, http.MethodDelete, "/api/v1/hosts/1", "", "id", "1")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var count int64
+	h.DB.Unscoped().Model(&model.Record{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("Expected records to be deleted but got %d", count)
+	}
+
+	if backend.deletes[len(backend.deletes)-1] != "_dmarc.blog.dyndns.example.com" {
+		t.Fatalf("Expected the record below the host to be deleted but got %v", backend.deletes)
+	}
+}
+
+func TestDeleteHostToDeleteDependentRowsFirst(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.DB.Exec("PRAGMA foreign_keys = ON")
+	for _, constraint := range []struct {
+		value interface{}
+		name  string
+	}{{&model.Log{}, "Host"}, {&model.CName{}, "Target"}, {&model.Record{}, "Host"}} {
+		if err := h.DB.Migrator().CreateConstraint(constraint.value, constraint.name); err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+	}
+
+	e := newTestEcho()
+	serve(e, h.APICreateHost, http.MethodPost, "/api/v1/hosts", testHostBody)
+	serve(e, h.APICreateCName, http.MethodPost, "/api/v1/cnames", `{"hostname":"www","target_id":1,"ttl":60}`)
+	serve(e, h.APICreateHostRecord, http.MethodPost, "/api/v1/records", `{"host_id":1,"type":"TXT","value":"text","ttl":3600}`)
+	h.DB.Create(&model.Log{HostID: 1, Message: "update"})
+
+	rec := serve(e, h.APIDeleteHost, http.MethodDelete, "/api/v1/hosts/1", "", "id", "1")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected status 204 but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	for _, value := range []interface{}{&model.Host{}, &model.Log{}, &model.CName{}, &model.Record{}} {
+		var count int64
+		h.DB.Unscoped().Model(value).Count(&count)
+		if count != 0 {
+			t.Fatalf("Expected %T rows to be deleted but got %d", value, count)
+		}
+	}
+}
+
+func TestCreateHostRecordToRejectNonNumericHostID(t *testing.T) {
+	h, _ := newTestHandler(t)
+	e := newTestEcho()
+	serve(e, h.APICreateHost, http.MethodPost, "/api/v1/hosts", testHostBody)
+
+	form := url.Values{"host_id": {"0 OR 1=1"}, "type": {"TXT"}, "value": {"text"}, "ttl": {"3600"}}
+	req := httptest.NewRequest(http.MethodPost, "/admin/records/add", strings.NewReader(form.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	setPrincipal(c, &Principal{Name: "admin", Role: model.RoleOwner})
+	h.CreateHostRecord(c)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 but got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/scheduler"
+	"github.com/labstack/gommon/log"
+)
+
+// retentionInterval is the interval old log entries are pruned in.
+const retentionInterval = time.Hour
+
+// initRetention reads how long and how many log entries are kept.
+func (h *Handler) initRetention() error {
+	if env := os.Getenv("DDNS_CLEAR_LOG_INTERVAL"); env != "" {
+		days, err := strconv.ParseUint(env, 10, 32)
+		if err != nil {
+			return fmt.Errorf("environment variable DDNS_CLEAR_LOG_INTERVAL is invalid: %w", err)
+		}
+		log.Info("log clear interval found: ", days, " days")
+		h.LogRetention = time.Duration(days) * 24 * time.Hour
+	}
+
+	if env := os.Getenv("DDNS_LOG_MAX_PER_HOST"); env != "" {
+		max, err := strconv.Atoi(env)
+		if err != nil || max < 0 {
+			return fmt.Errorf("environment variable DDNS_LOG_MAX_PER_HOST is invalid: %s", env)
+		}
+		log.Info("Keeping at most ", max, " log entries per host")
+		h.LogMaxPerHost = max
+	}
+
+	return nil
+}
+
+// ScheduleJobs adds the periodic jobs of the handler to s.
+func (h *Handler) ScheduleJobs(s *scheduler.Scheduler) {
+	if h.LogRetention > 0 || h.LogMaxPerHost > 0 {
+		s.Add("log retention", retentionInterval, h.PruneLogs)
+	}
+	s.Add("stale hosts", h.StaleCheckInterval, h.CheckStaleHosts)
+	if h.ACME != nil {
+		s.Add("certificate renewal", certRenewalInterval, h.ACME.Renew)
+	}
+}
+
+// PruneLogs deletes all log entries older than LogRetention
+// and all but the newest LogMaxPerHost entries of each host.
+func (h *Handler) PruneLogs(ctx context.Context) error {
+	db := h.DB.WithContext(ctx)
+
+	var deleted int64
+	if h.LogRetention > 0 {
+		result := db.Unscoped().Where("created_at < ?", time.Now().Add(-h.LogRetention)).Delete(&model.Log{})
+		if result.Error != nil {
+			return result.Error
+		}
+		deleted += result.RowsAffected
+	}
+
+	if h.LogMaxPerHost > 0 {
+		hostIDs := []uint{}
+		if err := db.Unscoped().Model(&model.Log{}).Group("host_id").Having("COUNT(*) > ?", h.LogMaxPerHost).Pluck("host_id", &hostIDs).Error; err != nil {
+			return err
+		}
+
+		for _, hostID := range hostIDs {
+			oldest := &model.Log{}
+			if err := db.Unscoped().Select("id").Where("host_id = ?", hostID).Order("id desc").Offset(h.LogMaxPerHost - 1).Limit(1).Take(oldest).Error; err != nil {
+				return err
+			}
+
+			result := db.Unscoped().Where("host_id = ? AND id < ?", hostID, oldest.ID).Delete(&model.Log{})
+			if result.Error != nil {
+				return result.Error
+			}
+			deleted += result.RowsAffected
+		}
+	}
+
+	if deleted > 0 {
+		log.Info("Log entries cleared: ", deleted)
+	}
+
+	return nil
+}
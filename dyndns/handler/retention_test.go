@@ -0,0 +1,33 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+)
+
+func TestPruneLogsToDeleteOldAndExcessEntries(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.LogRetention = 24 * time.Hour
+	h.LogMaxPerHost = 2
+
+	old := time.Now().Add(-48 * time.Hour)
+	h.DB.Create(&model.Log{HostID: 1, Message: "old"})
+	h.DB.Model(&model.Log{}).Where("message = ?", "old").Update("created_at", old)
+	for _, message := range []string{"a1", "a2", "a3", "a4"} {
+		h.DB.Create(&model.Log{HostID: 2, Message: message})
+	}
+	h.DB.Create(&model.Log{HostID: 3, Message: "b1"})
+
+	if err := h.PruneLogs(context.Background()); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	messages := []string{}
+	h.DB.Unscoped().Model(&model.Log{}).Order("id").Pluck("message", &messages)
+	if len(messages) != 3 || messages[0] != "a3" || messages[1] != "a4" || messages[2] != "b1" {
+		t.Fatalf("Expected entries a3, a4 and b1 to be kept but got %v", messages)
+	}
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/echo/v4"
+	l "github.com/labstack/gommon/log"
+)
+
+const (
+	sessionCookie     = "ddns_session"
+	defaultSessionTTL = 12 * time.Hour
+)
+
+// SessionAuth authenticates requests carrying a valid session cookie.
+// Requests without session are passed on to the next authentication.
+// The cookie is ignored on changing requests of other origins, so other sites can't forge them.
+func (h *Handler) SessionAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if GetPrincipal(c) != nil || crossOrigin(c.Request()) {
+			return next(c)
+		}
+
+		if session := h.findSession(c); session != nil {
+			setPrincipal(c, &Principal{Name: session.UserName, Role: session.Role})
+		}
+
+		return next(c)
+	}
+}
+
+// crossOrigin reports whether r is a changing request sent by another origin.
+// Browsers without Sec-Fetch-Site are checked by the Origin header.
+func crossOrigin(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site != "same-origin" && site != "none"
+	}
+
+	origin := r.Header.Get(echo.HeaderOrigin)
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+
+	return err != nil || u.Host != r.Host
+}
+
+// RequireLogin redirects browsers without session to the OIDC login,
+// instead of asking for basic auth credentials.
+func (h *Handler) RequireLogin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if GetPrincipal(c) == nil && c.Request().Header.Get(echo.HeaderAuthorization) == "" {
+			return c.Redirect(http.StatusFound, "/auth/login")
+		}
+
+		return next(c)
+	}
+}
+
+// findSession returns the unexpired session of the request cookie or nil.
+func (h *Handler) findSession(c echo.Context) *model.Session {
+	cookie, err := c.Cookie(sessionCookie)
+	if err != nil || cookie.Value == "" {
+		return nil
+	}
+
+	session := &model.Session{}
+	if err = h.DB.Where(&model.Session{Hash: hashToken(cookie.Value)}).First(session).Error; err != nil {
+		return nil
+	}
+
+	if session.Expired() {
+		return nil
+	}
+
+	return session
+}
+
+// createSession stores a new session and sets its cookie.
+func (h *Handler) createSession(c echo.Context, session *model.Session) error {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	secret := hex.EncodeToString(random)
+
+	session.Hash = hashToken(secret)
+	session.ExpiresAt = time.Now().Add(h.Config.OIDC.SessionTTL)
+
+	// clean up expired sessions on the way
+	if err := h.DB.Unscoped().Where("expires_at < ?", time.Now()).Delete(&model.Session{}).Error; err != nil {
+		l.Error("Error: ", err)
+	}
+
+	if err := h.DB.Create(session).Error; err != nil {
+		return err
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookie,
+		Value:    secret,
+		Path:     "/",
+		Expires:  session.ExpiresAt,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(h.Config.OIDC.RedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return nil
+}
+
+// Logout ends the session of the request and redirects to DDNS_LOGOUT_URL,
+// the logout page of the OIDC provider or the start page.
+func (h *Handler) Logout(c echo.Context) error {
+	session := h.findSession(c)
+	if session != nil {
+		if err := h.DB.Unscoped().Delete(session).Error; err != nil {
+			l.Error("Error: ", err)
+		}
+		h.audit(c, "logout", session.UserName)
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     sessionCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+
+	// either custom url
+	if len(h.LogoutUrl) > 0 {
+		return c.Redirect(http.StatusFound, h.LogoutUrl)
+	}
+
+	// or the end session endpoint of the identity provider
+	if session != nil && h.oidc != nil && h.oidc.endSessionURL != "" {
+		return c.Redirect(http.StatusFound, h.oidc.logoutURL(session.IDToken))
+	}
+
+	// or standard url
+	return c.Redirect(http.StatusFound, "../")
+}
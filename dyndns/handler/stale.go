@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/notify"
+	"github.com/labstack/gommon/log"
+)
+
+// defaultStaleCheckInterval is the interval the stale checker runs in.
+const defaultStaleCheckInterval = 5 * time.Minute
+
+// notifyTimeout limits notifications sent in the background of update requests.
+const notifyTimeout = 10 * time.Second
+
+// initNotify creates the notification channels and the stale check interval.
+func (h *Handler) initNotify() (err error) {
+	notifiers, err := notify.New(notify.Config{
+		WebhookURL:  os.Getenv("DDNS_NOTIFY_WEBHOOK_URL"),
+		SMTPAddr:    os.Getenv("DDNS_NOTIFY_SMTP_ADDR"),
+		SMTPFrom:    os.Getenv("DDNS_NOTIFY_SMTP_FROM"),
+		SMTPTo:      splitList(os.Getenv("DDNS_NOTIFY_SMTP_TO")),
+		NtfyURL:     os.Getenv("DDNS_NOTIFY_NTFY_URL"),
+		NtfyToken:   os.Getenv("DDNS_NOTIFY_NTFY_TOKEN"),
+		GotifyURL:   os.Getenv("DDNS_NOTIFY_GOTIFY_URL"),
+		GotifyToken: os.Getenv("DDNS_NOTIFY_GOTIFY_TOKEN"),
+	})
+	if err != nil {
+		return fmt.Errorf("notification config is invalid: %w", err)
+	}
+
+	if len(notifiers) > 0 {
+		log.Info("Notification channels set: ", len(notifiers))
+		h.notifier = notifiers
+	}
+
+	h.StaleCheckInterval = defaultStaleCheckInterval
+	if interval := os.Getenv("DDNS_STALE_CHECK_INTERVAL"); interval != "" {
+		if h.StaleCheckInterval, err = time.ParseDuration(interval); err != nil || h.StaleCheckInterval <= 0 {
+			return fmt.Errorf("environment variable DDNS_STALE_CHECK_INTERVAL is invalid: %s", interval)
+		}
+	}
+
+	return nil
+}
+
+// CheckStaleHosts flags all hosts, whose update is overdue, as stale and sends a notification for each.
+func (h *Handler) CheckStaleHosts(ctx context.Context) error {
+	hosts := []model.Host{}
+	if err := h.DB.Where("update_interval > 0 AND stale = ?", false).Find(&hosts).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for i := range hosts {
+		host := &hosts[i]
+		if !host.IsStale(now) {
+			continue
+		}
+
+		// only the replica flagging the host sends the notification
+		result := h.DB.Model(host).Where("stale = ?", false).Update("stale", true)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		lastSeen := "never"
+		if !host.LastSeen.IsZero() {
+			lastSeen = host.LastSeen.Format(time.RFC3339)
+		}
+		log.Warn("Host is stale: ", host.Hostname, ".", host.Domain)
+		h.notify(ctx, "stale", host, fmt.Sprintf("No update has been received since %s, updates are expected every %d minutes.", lastSeen, host.UpdateInterval))
+	}
+
+	return nil
+}
+
+// markSeen records that host has sent an update and notifies about the recovery of a stale host.
+// The notification is sent in the background, Close waits for it.
+func (h *Handler) markSeen(host *model.Host, now time.Time) {
+	recovered := host.Stale
+	host.LastSeen = now
+	host.Stale = false
+	if err := h.DB.Model(host).Select("last_seen", "stale").Updates(host).Error; err != nil {
+		log.Error(err)
+	}
+
+	if recovered {
+		recoveredHost := *host
+		h.notifying.Add(1)
+		go func() {
+			defer h.notifying.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			defer cancel()
+			h.notify(ctx, "recovered", &recoveredHost, "Updates are received again.")
+		}()
+	}
+}
+
+// notify sends a notification about event of host through all channels, failures are only logged.
+func (h *Handler) notify(ctx context.Context, event string, host *model.Host, body string) {
+	if h.notifier == nil {
+		return
+	}
+
+	name := host.Hostname + "." + host.Domain
+	msg := notify.Message{Event: event, Host: name, Title: name + " is " + event, Body: body}
+	if err := h.notifier.Notify(ctx, msg); err != nil {
+		log.Error("Error sending notification: ", err)
+	}
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/notify"
+)
+
+// fakeNotifier records all notifications.
+type fakeNotifier struct {
+	messages chan notify.Message
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	f.messages <- msg
+	return nil
+}
+
+func TestCheckStaleHostsToFlagAndRecoverHosts(t *testing.T) {
+	h, _ := newTestHandler(t)
+	notifier := &fakeNotifier{messages: make(chan notify.Message, 10)}
+	h.notifier = notifier
+
+	h.DB.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ipv4: "1.2.3.4", Ttl: 60, UpdateInterval: 60, LastSeen: time.Now().Add(-2 * time.Hour), UserName: "bloguser", Password: "blogpassword"})
+	h.DB.Create(&model.Host{Hostname: "shop", Domain: "dyndns.example.com", Ttl: 60, UpdateInterval: 60, LastSeen: time.Now(), UserName: "shopuser", Password: "shoppassword"})
+	h.DB.Create(&model.Host{Hostname: "static", Domain: "dyndns.example.com", Ttl: 60, UserName: "staticuser", Password: "staticpassword"})
+
+	if err := h.CheckStaleHosts(context.Background()); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	stale := []model.Host{}
+	h.DB.Where("stale = ?", true).Find(&stale)
+	if len(stale) != 1 || stale[0].Hostname != "blog" {
+		t.Fatalf("Expected only blog to be stale but got %+v", stale)
+	}
+
+	if msg := <-notifier.messages; msg.Event != "stale" || msg.Host != "blog.dyndns.example.com" {
+		t.Fatalf("Expected stale notification of blog but got %+v", msg)
+	}
+
+	if err := h.CheckStaleHosts(context.Background()); err != nil || len(notifier.messages) != 0 {
+		t.Fatalf("Expected stale hosts to be notified once but got %d more (%v)", len(notifier.messages), err)
+	}
+
+	if body := updateRequest(t, h, "bloguser", "blogpassword", "hostname=blog.dyndns.example.com&myip=1.2.3.4"); body != "nochg 1.2.3.4\n" {
+		t.Fatalf("Expected nochg but got %s", body)
+	}
+
+	select {
+	case msg := <-notifier.messages:
+		if msg.Event != "recovered" {
+			t.Fatalf("Expected recovered notification but got %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Expected recovered notification")
+	}
+
+	host := &model.Host{}
+	h.DB.Where("hostname = ?", "blog").First(host)
+	if host.Stale || host.LastSeen.Before(time.Now().Add(-time.Minute)) {
+		t.Fatalf("Expected blog to be seen and not stale but got %+v", host)
+	}
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+var errForbidden = errors.New("forbidden")
+
+// tenant returns the tenant the request is restricted to or nil.
+func tenant(c echo.Context) *model.User {
+	principal := GetPrincipal(c)
+	if principal == nil {
+		return nil
+	}
+
+	return principal.Tenant()
+}
+
+// tenantHosts restricts a query on hosts to the hosts the tenant of the request may access:
+// all hosts of its domains and the hosts it owns.
+func tenantHosts(c echo.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		user := tenant(c)
+		if user == nil {
+			return db
+		}
+
+		return db.Where("domain IN ? OR owner_id = ?", user.DomainList(), user.ID)
+	}
+}
+
+// tenantHostIDs returns a sub query selecting the ids of all hosts the tenant of the request may access.
+func (h *Handler) tenantHostIDs(c echo.Context) *gorm.DB {
+	return h.DB.Model(&model.Host{}).Select("id").Scopes(tenantHosts(c))
+}
+
+// tenantCNames restricts a query on cnames to the cnames of the hosts the tenant of the request may access.
+func (h *Handler) tenantCNames(c echo.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if tenant(c) == nil {
+			return db
+		}
+
+		return db.Where("target_id IN (?)", h.tenantHostIDs(c))
+	}
+}
+
+// tenantRecords restricts a query on records to the records of the hosts the tenant of the request may access.
+func (h *Handler) tenantRecords(c echo.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if tenant(c) == nil {
+			return db
+		}
+
+		return db.Where("host_id IN (?)", h.tenantHostIDs(c))
+	}
+}
+
+// tenantLogs restricts a query on log entries to the logs of the hosts the tenant of the request may access.
+func (h *Handler) tenantLogs(c echo.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if tenant(c) == nil {
+			return db
+		}
+
+		return db.Where("host_id IN (?)", h.tenantHostIDs(c))
+	}
+}
+
+// tenantAudits restricts a query on admin actions to the actions of the tenant of the request.
+func tenantAudits(c echo.Context) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		user := tenant(c)
+		if user == nil {
+			return db
+		}
+
+		return db.Where(&model.Audit{UserName: user.UserName})
+	}
+}
+
+// tenantDomains returns the configured domains the tenant of the request may create hosts in.
+func (h *Handler) tenantDomains(c echo.Context) []string {
+	user := tenant(c)
+	if user == nil {
+		return h.Config.Domains
+	}
+
+	domains := []string{}
+	for _, domain := range h.Config.Domains {
+		if user.HasDomain(domain) {
+			domains = append(domains, domain)
+		}
+	}
+
+	return domains
+}
+
+// checkOwner fails if the owner of a host is changed by a tenant or the owner doesn't exist.
+func (h *Handler) checkOwner(c echo.Context, ownerID *uint) error {
+	if ownerID == nil {
+		return nil
+	}
+
+	if tenant(c) != nil {
+		return fmt.Errorf("%w: the owner can not be changed by tenants", errForbidden)
+	}
+
+	if *ownerID != 0 {
+		if err := h.DB.First(&model.User{}, *ownerID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: owner %d not found", errInvalidRequest, *ownerID)
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyTenant fails if the tenant of the request must not create hosts in the domain of host,
+// otherwise the new host is owned by the tenant.
+func applyTenant(c echo.Context, host *model.Host) error {
+	user := tenant(c)
+	if user == nil {
+		return nil
+	}
+
+	if !user.HasDomain(host.Domain) {
+		return fmt.Errorf("%w: domain %s is not managed by you", errForbidden, host.Domain)
+	}
+	host.OwnerID = user.ID
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+)
+
+func TestTenantToSeeOnlyOwnDomainsAndHosts(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.Config.Domains = []string{"dyndns.example.com", "dyndns.example.org"}
+	e := newRoleTestEcho(h)
+
+	tenant := &model.User{UserName: "tenant", Password: "tenantpassword", Role: model.RoleOperator, Tenant: true, Domains: "dyndns.example.com"}
+	h.DB.Create(tenant)
+	h.DB.Create(&model.Host{Hostname: "a", Domain: "dyndns.example.com", Ttl: 60, UserName: "auser", Password: "password"})
+	h.DB.Create(&model.Host{Hostname: "b", Domain: "dyndns.example.org", Ttl: 60, UserName: "buser", Password: "password"})
+	h.DB.Create(&model.Host{Hostname: "c", Domain: "dyndns.example.org", Ttl: 60, UserName: "cuser", Password: "password", OwnerID: tenant.ID})
+
+	foreign := `{"hostname":"dhost","domain":"dyndns.example.org","ttl":60,"username":"duser","password":"dpassword"}`
+	if code := loginRequest(e, http.MethodPost, "/api/v1/hosts", foreign, "tenant"); code != http.StatusForbidden {
+		t.Fatalf("Expected status 403 for a foreign domain but got %d", code)
+	}
+
+	if code := loginRequest(e, http.MethodPost, "/api/v1/hosts", testHostBody, "tenant"); code != http.StatusCreated {
+		t.Fatalf("Expected status 201 but got %d", code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/hosts", nil)
+	req.SetBasicAuth("tenant", "tenantpassword")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	page := &struct {
+		Items []hostResponse `json:"items"`
+	}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), page); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	names := []string{}
+	for _, host := range page.Items {
+		names = append(names, host.Hostname)
+	}
+	if strings.Join(names, ",") != "a,c,blog" {
+		t.Fatalf("Expected hosts a, c and blog but got %v", names)
+	}
+
+	if page.Items[2].OwnerID != tenant.ID {
+		t.Fatalf("Expected new host to be owned by the tenant but got %d", page.Items[2].OwnerID)
+	}
+}
+
+func TestTenantToNotAccessForeignHost(t *testing.T) {
+	h, _ := newTestHandler(t)
+	tenant := &model.User{UserName: "tenant", Password: "tenantpassword", Role: model.RoleOperator, Tenant: true, Domains: "dyndns.example.com"}
+	h.DB.Create(tenant)
+	h.DB.Create(&model.Host{Hostname: "b", Domain: "dyndns.example.org", Ttl: 60, UserName: "buser", Password: "password"})
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/hosts/1", nil)
+	rec := httptest.NewRecorder()
+	c := newTestEcho().NewContext(req, rec)
+	setPrincipal(c, &Principal{Name: tenant.UserName, Role: tenant.Role, User: tenant})
+	c.SetParamNames("id")
+	c.SetParamValues("1")
+
+	h.APIDeleteHost(c)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Expected status 404 but got %d", rec.Code)
+	}
+
+	var count int64
+	h.DB.Model(&model.Host{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("Expected foreign host to be kept")
+	}
+}
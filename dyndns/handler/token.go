@@ -0,0 +1,231 @@
+package handler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/echo/v4"
+	l "github.com/labstack/gommon/log"
+)
+
+const tokenPrefix = "ddns_"
+
+type tokenResponse struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	Prefix    string    `json:"prefix"`
+	Scopes    []string  `json:"scopes"`
+	LastUsed  time.Time `json:"last_used"`
+	CreatedAt time.Time `json:"created_at"`
+	// Token is only returned once when the token is created.
+	Token string `json:"token,omitempty"`
+}
+
+type tokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+func newTokenResponse(token *model.Token) *tokenResponse {
+	return &tokenResponse{
+		ID:        token.ID,
+		Name:      token.Name,
+		Prefix:    token.Prefix,
+		Scopes:    token.ScopeList(),
+		LastUsed:  token.LastUsed,
+		CreatedAt: token.CreatedAt,
+	}
+}
+
+// bearerToken returns the token of a "Authorization: Bearer <token>" header.
+func bearerToken(c echo.Context) (string, bool) {
+	auth := c.Request().Header.Get(echo.HeaderAuthorization)
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "bearer ") {
+		return strings.TrimSpace(auth[7:]), true
+	}
+
+	return "", false
+}
+
+// HasBearerToken tells if the request is authenticated with an api token,
+// it is used to skip the basic auth middleware.
+func HasBearerToken(c echo.Context) bool {
+	_, ok := bearerToken(c)
+	return ok
+}
+
+// hashToken returns the hash an api token is stored with.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenAuth authenticates requests carrying a bearer api token.
+// Requests without bearer token are passed on to the next authentication.
+func (h *Handler) TokenAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		secret, ok := bearerToken(c)
+		if !ok {
+			return next(c)
+		}
+
+		token := &model.Token{}
+		if err := h.DB.Where(&model.Token{Hash: hashToken(secret)}).First(token).Error; err != nil {
+			c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+			return c.JSON(http.StatusUnauthorized, &Error{"invalid api token"})
+		}
+
+		if err := h.DB.Model(token).UpdateColumn("last_used", time.Now()).Error; err != nil {
+			l.Error("Error: ", err)
+		}
+
+		setPrincipal(c, &Principal{Name: "token:" + token.Name, Token: token})
+
+		return next(c)
+	}
+}
+
+// RequireScope restricts a route to principals holding at least one of the given scopes,
+// either granted to their api token or by their role.
+func (h *Handler) RequireScope(scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			principal := GetPrincipal(c)
+			if principal == nil {
+				return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+			}
+
+			for _, scope := range scopes {
+				if principal.HasScope(scope) {
+					return next(c)
+				}
+			}
+
+			return c.JSON(http.StatusForbidden, &Error{fmt.Sprintf("requires one of the scopes: %s", strings.Join(scopes, ", "))})
+		}
+	}
+}
+
+// ListTokens fetches all api tokens from database and lists them on the website.
+func (h *Handler) ListTokens(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	tokens := new([]model.Token)
+	if err = h.DB.Order("name").Find(tokens).Error; err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	return c.Render(http.StatusOK, "listtokens", echo.Map{
+		"tokens": tokens,
+		"scopes": model.TokenScopes,
+		"title":  h.Title,
+	})
+}
+
+// APIListTokens returns all api tokens without their secrets.
+func (h *Handler) APIListTokens(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	tokens := new([]model.Token)
+	if err = h.DB.Order("name").Find(tokens).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	items := []*tokenResponse{}
+	for i := range *tokens {
+		items = append(items, newTokenResponse(&(*tokens)[i]))
+	}
+
+	return c.JSON(http.StatusOK, items)
+}
+
+// APICreateToken creates a named api token with the requested scopes.
+// The token itself is only returned by this request.
+func (h *Handler) APICreateToken(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	req := &tokenRequest{}
+	if err = c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	if len(req.Scopes) == 0 {
+		return c.JSON(http.StatusBadRequest, &Error{"at least one scope is required"})
+	}
+
+	for _, scope := range req.Scopes {
+		if !model.ValidScope(scope) {
+			return c.JSON(http.StatusBadRequest, &Error{fmt.Sprintf("unknown scope: %s", scope)})
+		}
+	}
+
+	random := make([]byte, 32)
+	if _, err = rand.Read(random); err != nil {
+		return apiError(c, err)
+	}
+	secret := tokenPrefix + hex.EncodeToString(random)
+
+	token := &model.Token{
+		Name:   req.Name,
+		Hash:   hashToken(secret),
+		Prefix: secret[:len(tokenPrefix)+6],
+		Scopes: strings.Join(req.Scopes, ","),
+	}
+
+	if err = c.Validate(token); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.DB.Where(&model.Token{Name: token.Name}).First(&model.Token{}).Error; err == nil {
+		return c.JSON(http.StatusConflict, &Error{"token name already exists"})
+	}
+
+	if err = h.DB.Create(token).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "create token", token.Name+" ("+token.Scopes+")")
+
+	resp := newTokenResponse(token)
+	resp.Token = secret
+
+	return c.JSON(http.StatusCreated, resp)
+}
+
+// APIRevokeToken deletes an api token by "id", it can't be used afterwards.
+func (h *Handler) APIRevokeToken(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	token := &model.Token{}
+	if err = h.DB.First(token, id).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.DB.Unscoped().Delete(token).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "revoke token", token.Name)
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/echo/v4"
+)
+
+// newTokenTestEcho registers a read and a write route guarded by TokenAuth and RequireScope.
+func newTokenTestEcho(h *Handler) *echo.Echo {
+	e := newTestEcho()
+	g := e.Group("/api/v1", h.TokenAuth, h.NoAuth)
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	g.GET("/hosts", ok, h.RequireScope(model.ScopeReadOnly, model.ScopeHostsWrite))
+	g.POST("/hosts", ok, h.RequireScope(model.ScopeHostsWrite))
+	g.POST("/tokens", h.APICreateToken, h.RequireScope(model.ScopeAdmin))
+
+	return e
+}
+
+func request(e *echo.Echo, method string, path string, body string, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	return rec
+}
+
+func createToken(t *testing.T, e *echo.Echo, body string) string {
+	rec := request(e, http.MethodPost, "/api/v1/tokens", body, "")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	resp := &tokenResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	return resp.Token
+}
+
+func TestTokenAuthToEnforceScopes(t *testing.T) {
+	h, _ := newTestHandler(t)
+	e := newTokenTestEcho(h)
+	token := createToken(t, e, `{"name":"ci","scopes":["read-only"]}`)
+
+	if rec := request(e, http.MethodGet, "/api/v1/hosts", "", token); rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 but got %d", rec.Code)
+	}
+
+	if rec := request(e, http.MethodPost, "/api/v1/hosts", "", token); rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected status 403 but got %d", rec.Code)
+	}
+
+	if rec := request(e, http.MethodPost, "/api/v1/tokens", `{"name":"other","scopes":["read-only"]}`, token); rec.Code != http.StatusForbidden {
+		t.Fatalf("Expected tokens not to create tokens but got status %d", rec.Code)
+	}
+}
+
+func TestTokenAuthToRejectUnknownAndRevokedTokens(t *testing.T) {
+	h, _ := newTestHandler(t)
+	e := newTokenTestEcho(h)
+	token := createToken(t, e, `{"name":"ci","scopes":["hosts:write"]}`)
+
+	if rec := request(e, http.MethodGet, "/api/v1/hosts", "", "ddns_unknown"); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 but got %d", rec.Code)
+	}
+
+	stored := &model.Token{}
+	h.DB.First(stored)
+	if stored.Hash == token || stored.Hash != hashToken(token) {
+		t.Fatalf("Expected only the token hash to be stored")
+	}
+
+	h.DB.Unscoped().Delete(stored)
+	if rec := request(e, http.MethodPost, "/api/v1/hosts", "", token); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 for revoked token but got %d", rec.Code)
+	}
+}
+
+func TestAPICreateTokenToRejectUnknownScopes(t *testing.T) {
+	h, _ := newTestHandler(t)
+	e := newTokenTestEcho(h)
+
+	if rec := request(e, http.MethodPost, "/api/v1/tokens", `{"name":"ci","scopes":["admin"]}`, ""); rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 but got %d", rec.Code)
+	}
+}
@@ -0,0 +1,247 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/echo/v4"
+)
+
+type userResponse struct {
+	ID        uint      `json:"id"`
+	UserName  string    `json:"username"`
+	Role      string    `json:"role"`
+	Tenant    bool      `json:"tenant"`
+	Domains   []string  `json:"domains"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// userRequest is the body of POST and PATCH requests on admin users.
+// Fields missing in a PATCH request are left untouched.
+type userRequest struct {
+	UserName *string   `json:"username"`
+	Password *string   `json:"password"`
+	Role     *string   `json:"role"`
+	Tenant   *bool     `json:"tenant"`
+	Domains  *[]string `json:"domains"`
+}
+
+func newUserResponse(user *model.User) *userResponse {
+	return &userResponse{
+		ID:        user.ID,
+		UserName:  user.UserName,
+		Role:      user.Role,
+		Tenant:    user.Tenant,
+		Domains:   user.DomainList(),
+		CreatedAt: user.CreatedAt,
+		UpdatedAt: user.UpdatedAt,
+	}
+}
+
+// ListUsers fetches all admin users from database and lists them on the website.
+func (h *Handler) ListUsers(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	users := new([]model.User)
+	if err = h.DB.Order("user_name").Find(users).Error; err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	return c.Render(http.StatusOK, "listusers", echo.Map{
+		"users":   users,
+		"roles":   model.Roles,
+		"domains": h.Config.Domains,
+		"title":   h.Title,
+	})
+}
+
+// APIListUsers returns all admin users without their passwords.
+func (h *Handler) APIListUsers(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	users := new([]model.User)
+	if err = h.DB.Order("user_name").Find(users).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	items := []*userResponse{}
+	for i := range *users {
+		items = append(items, newUserResponse(&(*users)[i]))
+	}
+
+	return c.JSON(http.StatusOK, items)
+}
+
+// APICreateUser creates an admin user with a role.
+func (h *Handler) APICreateUser(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	req := &userRequest{}
+	if err = c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	if req.UserName == nil || req.Password == nil || req.Role == nil {
+		return apiError(c, fmt.Errorf("%w: username, password and role are required", errInvalidRequest))
+	}
+
+	user := &model.User{UserName: *req.UserName, Password: *req.Password, Role: *req.Role}
+	req.applyTenant(user)
+	if err = h.validateUser(c, user); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.DB.Where(&model.User{UserName: user.UserName}).First(&model.User{}).Error; err == nil {
+		return c.JSON(http.StatusConflict, &Error{"username already exists"})
+	}
+
+	if err = h.DB.Create(user).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "create user", user.UserName+" ("+user.Role+")")
+
+	return c.JSON(http.StatusCreated, newUserResponse(user))
+}
+
+// APIPatchUser changes the role or password of an admin user by "id".
+func (h *Handler) APIPatchUser(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	user := &model.User{}
+	if err = h.DB.First(user, id).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	req := &userRequest{}
+	if err = c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	if req.UserName != nil && *req.UserName != user.UserName {
+		return apiError(c, fmt.Errorf("%w: username can not be changed", errInvalidRequest))
+	}
+
+	if req.Role != nil && *req.Role != user.Role {
+		if err = h.checkOwnerLeft(user); err != nil {
+			return apiError(c, err)
+		}
+		user.Role = *req.Role
+	}
+	if req.Password != nil && *req.Password != "" {
+		user.Password = *req.Password
+	}
+	req.applyTenant(user)
+
+	if err = h.validateUser(c, user); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.DB.Save(user).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "update user", user.UserName+" ("+user.Role+")")
+
+	return c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// APIDeleteUser deletes an admin user by "id".
+func (h *Handler) APIDeleteUser(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	user := &model.User{}
+	if err = h.DB.First(user, id).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.checkOwnerLeft(user); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.DB.Unscoped().Delete(user).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "delete user", user.UserName)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// applyTenant copies the tenant fields of the request to user.
+func (r *userRequest) applyTenant(user *model.User) {
+	if r.Tenant != nil {
+		user.Tenant = *r.Tenant
+	}
+	if r.Domains != nil {
+		user.Domains = strings.Join(*r.Domains, ",")
+	}
+}
+
+// validateUser validates user and its tenant settings.
+// Tenants can't be owners and are restricted to configured domains.
+func (h *Handler) validateUser(c echo.Context, user *model.User) error {
+	if err := c.Validate(user); err != nil {
+		return err
+	}
+
+	if !user.Tenant {
+		return nil
+	}
+
+	if user.Role == model.RoleOwner {
+		return fmt.Errorf("%w: tenants can not be owners", errInvalidRequest)
+	}
+
+	for _, domain := range user.DomainList() {
+		if !h.isDomain(domain) {
+			return fmt.Errorf("%w: domain %s is not handled by this server", errInvalidRequest, domain)
+		}
+	}
+
+	return nil
+}
+
+// checkOwnerLeft prevents removing the owner role from user,
+// if it is the last owner and no owner is configured by DDNS_ADMIN_LOGIN.
+func (h *Handler) checkOwnerLeft(user *model.User) error {
+	if user.Role != model.RoleOwner || h.Config.AdminLogin != "" {
+		return nil
+	}
+
+	var owners int64
+	if err := h.DB.Model(&model.User{}).Where(&model.User{Role: model.RoleOwner}).Count(&owners).Error; err != nil {
+		return err
+	}
+
+	if owners <= 1 {
+		return fmt.Errorf("%w: the last owner can not be removed", errInvalidRequest)
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"gorm.io/gorm"
+)
+
+// newRoleTestEcho registers the host routes guarded like the api group in main.go.
+func newRoleTestEcho(h *Handler) *echo.Echo {
+	e := newTestEcho()
+	g := e.Group("/api/v1", h.TokenAuth, middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Skipper:   h.SkipAdminAuth,
+		Validator: h.AuthenticateAdmin,
+	}), h.NoAuth)
+	g.GET("/hosts", h.APIListHosts, h.RequireScope(model.ScopeReadOnly, model.ScopeHostsWrite))
+	g.POST("/hosts", h.APICreateHost, h.RequireScope(model.ScopeHostsWrite))
+	g.POST("/users", h.APICreateUser, h.RequireScope(model.ScopeAdmin))
+
+	return e
+}
+
+func loginRequest(e *echo.Echo, method string, path string, body string, username string) int {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.SetBasicAuth(username, username+"password")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	return rec.Code
+}
+
+func TestNoAuthToCountAdminUsersOncePerRequest(t *testing.T) {
+	h, _ := newTestHandler(t)
+	e := newRoleTestEcho(h)
+
+	queries := 0
+	h.DB.Callback().Query().Before("gorm:query").Register("test:count_users", func(db *gorm.DB) {
+		if db.Statement.Table == "users" {
+			queries++
+		}
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/hosts", nil)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK || queries != 1 {
+		t.Fatalf("Expected status 200 with one users query but got %d with %d queries", rec.Code, queries)
+	}
+}
+
+func TestRolesToRestrictAdminActions(t *testing.T) {
+	h, _ := newTestHandler(t)
+	e := newRoleTestEcho(h)
+	for _, role := range model.Roles {
+		h.DB.Create(&model.User{UserName: role, Password: role + "password", Role: role})
+	}
+
+	if code := loginRequest(e, http.MethodGet, "/api/v1/hosts", "", model.RoleViewer); code != http.StatusOK {
+		t.Fatalf("Expected viewer to read hosts but got %d", code)
+	}
+
+	if code := loginRequest(e, http.MethodPost, "/api/v1/hosts", testHostBody, model.RoleViewer); code != http.StatusForbidden {
+		t.Fatalf("Expected viewer not to create hosts but got %d", code)
+	}
+
+	if code := loginRequest(e, http.MethodPost, "/api/v1/hosts", testHostBody, model.RoleOperator); code != http.StatusCreated {
+		t.Fatalf("Expected operator to create hosts but got %d", code)
+	}
+
+	body := `{"username":"someone","password":"somepassword","role":"owner"}`
+	if code := loginRequest(e, http.MethodPost, "/api/v1/users", body, model.RoleOperator); code != http.StatusForbidden {
+		t.Fatalf("Expected operator not to create users but got %d", code)
+	}
+
+	if code := loginRequest(e, http.MethodPost, "/api/v1/users", body, model.RoleOwner); code != http.StatusCreated {
+		t.Fatalf("Expected owner to create users but got %d", code)
+	}
+
+	// unknown users are rejected as soon as admin users exist
+	if code := loginRequest(e, http.MethodGet, "/api/v1/hosts", "", "nobody"); code != http.StatusUnauthorized {
+		t.Fatalf("Expected status 401 but got %d", code)
+	}
+
+	audits := []model.Audit{}
+	h.DB.Order("id").Find(&audits)
+	if len(audits) != 2 || audits[0].UserName != model.RoleOperator || audits[0].Object != "blog.dyndns.example.com" || audits[1].UserName != model.RoleOwner {
+		t.Fatalf("Expected actions attributed to operator and owner but got %+v", audits)
+	}
+}
+
+func TestAPIDeleteUserToKeepLastOwner(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.DB.Create(&model.User{UserName: "owner", Password: "ownerpassword", Role: model.RoleOwner})
+
+	rec := serve(newTestEcho(), h.APIDeleteUser, http.MethodDelete, "/api/v1/users/1", "", "id", "1")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 but got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestAPIDeleteUserToRejectNonNumericID(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.DB.Create(&model.User{UserName: "bob", Password: "bobpassword", Role: model.RoleViewer})
+
+	rec := serve(newTestEcho(), h.APIDeleteUser, http.MethodDelete, "/api/v1/users/x", "", "id", "user_name = 'bob'")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var count int64
+	h.DB.Model(&model.User{}).Count(&count)
+	if count != 1 {
+		t.Fatal("Expected bob not to be deleted")
+	}
+}
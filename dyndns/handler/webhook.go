@@ -0,0 +1,274 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/webhook"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type webhookResponse struct {
+	ID        uint      `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	HostID    uint      `json:"host_id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Secret is only returned once when the webhook is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+// webhookRequest is the body of POST requests on webhooks.
+// A random secret is generated, if none is given.
+type webhookRequest struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"`
+	Events []string `json:"events"`
+	HostID uint     `json:"host_id"`
+}
+
+type webhookDeliveryResponse struct {
+	ID         uint      `json:"id"`
+	WebhookID  uint      `json:"webhook_id"`
+	Event      string    `json:"event"`
+	Host       string    `json:"host"`
+	Payload    string    `json:"payload"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"status_code"`
+	Error      string    `json:"error"`
+	Success    bool      `json:"success"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func newWebhookResponse(hook *model.Webhook) *webhookResponse {
+	return &webhookResponse{
+		ID:        hook.ID,
+		URL:       hook.URL,
+		Events:    hook.EventList(),
+		HostID:    hook.HostID,
+		CreatedAt: hook.CreatedAt,
+	}
+}
+
+func newWebhookDeliveryResponse(delivery *model.WebhookDelivery) *webhookDeliveryResponse {
+	return &webhookDeliveryResponse{
+		ID:         delivery.ID,
+		WebhookID:  delivery.WebhookID,
+		Event:      delivery.Event,
+		Host:       delivery.Host,
+		Payload:    delivery.Payload,
+		Attempts:   delivery.Attempts,
+		StatusCode: delivery.StatusCode,
+		Error:      delivery.Error,
+		Success:    delivery.Success,
+		CreatedAt:  delivery.CreatedAt,
+		UpdatedAt:  delivery.UpdatedAt,
+	}
+}
+
+// hostEvent returns a webhook event of host.
+func hostEvent(event string, host *model.Host) webhook.Event {
+	return webhook.Event{
+		Event:     event,
+		HostID:    host.ID,
+		Host:      host.Hostname + "." + host.Domain,
+		Timestamp: time.Now(),
+	}
+}
+
+// hostIPs returns the addresses of host as comma separated list.
+func hostIPs(host *model.Host) string {
+	return strings.Trim(host.Ipv4+","+host.Ipv6, ",")
+}
+
+// dispatchUpdateFailed sends the update_failed event of an update request to the webhooks.
+func (h *Handler) dispatchUpdateFailed(host *model.Host, log *model.Log, message string) {
+	event := hostEvent(model.EventUpdateFailed, host)
+	event.OldIP = hostIPs(host)
+	event.NewIP = log.SentIP
+	event.CallerIP = log.CallerIP
+	event.Message = message
+	event.Timestamp = log.TimeStamp
+	h.webhooks.Dispatch(event)
+}
+
+// ListWebhooks fetches all webhooks and their latest deliveries from database and lists them on the website.
+func (h *Handler) ListWebhooks(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	webhooks := new([]model.Webhook)
+	if err = h.DB.Order("id").Find(webhooks).Error; err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	deliveries := new([]model.WebhookDelivery)
+	if err = h.DB.Order("created_at desc").Limit(50).Find(deliveries).Error; err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	hosts := new([]model.Host)
+	if err = h.DB.Order("domain, hostname").Find(hosts).Error; err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	hostNames := map[uint]string{}
+	for _, host := range *hosts {
+		hostNames[host.ID] = host.Hostname + "." + host.Domain
+	}
+
+	return c.Render(http.StatusOK, "listwebhooks", echo.Map{
+		"webhooks":   webhooks,
+		"deliveries": deliveries,
+		"hosts":      hosts,
+		"hostNames":  hostNames,
+		"events":     model.WebhookEvents,
+		"title":      h.Title,
+	})
+}
+
+// APIListWebhooks returns all webhooks without their secrets.
+func (h *Handler) APIListWebhooks(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	webhooks := new([]model.Webhook)
+	if err = h.DB.Order("id").Find(webhooks).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	items := []*webhookResponse{}
+	for i := range *webhooks {
+		items = append(items, newWebhookResponse(&(*webhooks)[i]))
+	}
+
+	return c.JSON(http.StatusOK, items)
+}
+
+// APICreateWebhook creates a webhook and returns its secret once.
+func (h *Handler) APICreateWebhook(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	req := &webhookRequest{}
+	if err = c.Bind(req); err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	for _, event := range req.Events {
+		if !model.ValidEvent(event) {
+			return c.JSON(http.StatusBadRequest, &Error{fmt.Sprintf("unknown event: %s", event)})
+		}
+	}
+
+	if req.HostID != 0 {
+		if err = h.DB.First(&model.Host{}, req.HostID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.JSON(http.StatusBadRequest, &Error{"host does not exist"})
+			}
+			return apiError(c, err)
+		}
+	}
+
+	if req.Secret == "" {
+		req.Secret = randomString()
+	}
+
+	hook := &model.Webhook{
+		URL:    req.URL,
+		Secret: req.Secret,
+		Events: strings.Join(req.Events, ","),
+		HostID: req.HostID,
+	}
+
+	if err = c.Validate(hook); err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.DB.Create(hook).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "create webhook", hook.URL)
+
+	resp := newWebhookResponse(hook)
+	resp.Secret = hook.Secret
+
+	return c.JSON(http.StatusCreated, resp)
+}
+
+// APIDeleteWebhook deletes a webhook by "id", its delivery log is kept.
+func (h *Handler) APIDeleteWebhook(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	hook := &model.Webhook{}
+	if err = h.DB.First(hook, id).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	if err = h.DB.Unscoped().Delete(hook).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	h.audit(c, "delete webhook", hook.URL)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// APIListWebhookDeliveries returns a page of webhook deliveries, newest first, optionally filtered by "webhook_id" and "success".
+func (h *Handler) APIListWebhookDeliveries(c echo.Context) (err error) {
+	if GetPrincipal(c) == nil {
+		return c.JSON(http.StatusUnauthorized, &Error{UNAUTHORIZED})
+	}
+
+	query := h.DB.Model(&model.WebhookDelivery{})
+	if param := c.QueryParam("webhook_id"); param != "" {
+		webhookID, err := strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+		}
+		query = query.Where("webhook_id = ?", webhookID)
+	}
+	if param := c.QueryParam("success"); param != "" {
+		success, err := strconv.ParseBool(param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+		}
+		query = query.Where("success = ?", success)
+	}
+
+	query, page, err := paginate(c, query)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, &Error{err.Error()})
+	}
+
+	deliveries := new([]model.WebhookDelivery)
+	if err = query.Order("created_at desc").Find(deliveries).Error; err != nil {
+		return apiError(c, err)
+	}
+
+	items := []*webhookDeliveryResponse{}
+	for i := range *deliveries {
+		items = append(items, newWebhookDeliveryResponse(&(*deliveries)[i]))
+	}
+	page.Items = items
+
+	return c.JSON(http.StatusOK, page)
+}
@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/webhook"
+)
+
+func TestAPICreateWebhookToGenerateSecret(t *testing.T) {
+	h, _ := newTestHandler(t)
+	e := newTestEcho()
+
+	rec := serve(e, h.APICreateWebhook, http.MethodPost, "/api/v1/webhooks", `{"url":"https://example.com/hook","events":["ip_change"]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("Expected status 201 but got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	resp := &webhookResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), resp); err != nil || len(resp.Secret) < 16 {
+		t.Fatalf("Expected generated secret but got %s", rec.Body.String())
+	}
+
+	rec = serve(e, h.APICreateWebhook, http.MethodPost, "/api/v1/webhooks", `{"url":"https://example.com/hook","events":["unknown"]}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Expected status 400 but got %d", rec.Code)
+	}
+}
+
+func TestUpdateIPToDispatchIPChange(t *testing.T) {
+	events := make(chan webhook.Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		event := webhook.Event{}
+		json.Unmarshal(body, &event)
+		events <- event
+	}))
+	defer srv.Close()
+
+	h, _ := newTestHandler(t)
+	h.webhooks = webhook.NewDispatcher(h.DB)
+	h.DB.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ipv4: "1.1.1.1", Ttl: 60, UserName: "bloguser", Password: "blogpassword"})
+	h.DB.Create(&model.Webhook{URL: srv.URL, Secret: "0123456789abcdef", Events: model.EventIPChange})
+
+	updateRequest(t, h, "bloguser", "blogpassword", "hostname=blog.dyndns.example.com&myip=1.2.3.4")
+
+	select {
+	case event := <-events:
+		if event.Event != model.EventIPChange || event.Host != "blog.dyndns.example.com" || event.OldIP != "1.1.1.1" || event.NewIP != "1.2.3.4" {
+			t.Fatalf("Expected ip_change from 1.1.1.1 to 1.2.3.4 but got %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected webhook delivery")
+	}
+	h.webhooks.Close()
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"html/template"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/benjaminbear/docker-ddns-server/dyndns/handler"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/metrics"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/scheduler"
 	"github.com/foolin/goview"
 	"github.com/foolin/goview/supports/echoview-v4"
 	"github.com/go-playground/validator/v10"
@@ -14,7 +23,18 @@ import (
 	"github.com/labstack/gommon/log"
 )
 
+// shutdownTimeout is the time running requests get to finish on shutdown.
+const shutdownTimeout = 15 * time.Second
+
 func main() {
+	// "migrate" only migrates the database schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Set new instance
 	e := echo.New()
 
@@ -49,70 +69,232 @@ func main() {
 		e.Logger.Fatal(err)
 	}
 
-	authAdmin, err := h.ParseEnvs()
-	if err != nil {
+	if err := h.ParseEnvs(); err != nil {
 		e.Logger.Fatal(err)
 	}
 
+	// Stop on SIGINT and SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Builtin name server
+	if h.DNSServer != nil {
+		go func() {
+			if err := h.DNSServer.ListenAndServe(h.Config.DNSListen); err != nil {
+				e.Logger.Fatal(err)
+			}
+		}()
+	}
+
+	// Background jobs: log retention, stale host detection and certificate renewal
+	jobs := scheduler.New()
+	h.ScheduleJobs(jobs)
+	jobs.Start(ctx)
+
+	// The update endpoints get their own plain http server, if they listen on another address.
+	// With tls they are served on both servers, so legacy routers can still update.
+	var plain *echo.Echo
+	updateServers := []*echo.Echo{e}
+	if h.Config.UpdateListen != "" && h.Config.UpdateListen != h.Config.Listen {
+		plain = echo.New()
+		plain.HideBanner = true
+		plain.Logger.SetLevel(log.ERROR)
+		plain.Use(middleware.Logger())
+
+		updateServers = []*echo.Echo{plain}
+		if h.ACME != nil {
+			updateServers = append(updateServers, e)
+		}
+	}
+
 	// UI Routes
 	groupPublic := e.Group("/")
 	groupPublic.GET("*", func(c echo.Context) error {
 		//redirect to admin
 		return c.Redirect(301, "./admin/")
 	})
+	// Route scopes of api tokens and admin roles
+	readHosts := h.RequireScope(model.ScopeReadOnly, model.ScopeHostsWrite)
+	writeHosts := h.RequireScope(model.ScopeHostsWrite)
+	readCNames := h.RequireScope(model.ScopeReadOnly, model.ScopeCNamesWrite)
+	writeCNames := h.RequireScope(model.ScopeCNamesWrite)
+	readLogs := h.RequireScope(model.ScopeLogsRead)
+	adminOnly := h.RequireScope(model.ScopeAdmin)
+
 	groupAdmin := e.Group("/admin")
-	if authAdmin {
-		groupAdmin.Use(middleware.BasicAuth(h.AuthenticateAdmin))
+	groupAdmin.Use(h.TokenAuth)
+	groupAdmin.Use(h.SessionAuth)
+	if h.OIDCEnabled() {
+		groupAdmin.Use(h.RequireLogin)
 	}
+	groupAdmin.Use(middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Skipper:   h.SkipAdminAuth,
+		Validator: h.AuthenticateAdmin,
+	}))
+	groupAdmin.Use(h.NoAuth)
 
-	groupAdmin.GET("/", h.ListHosts)
-	groupAdmin.GET("/hosts/add", h.AddHost)
-	groupAdmin.GET("/hosts/edit/:id", h.EditHost)
-	groupAdmin.GET("/hosts", h.ListHosts)
-	groupAdmin.GET("/cnames/add", h.AddCName)
-	groupAdmin.GET("/cnames", h.ListCNames)
-	groupAdmin.GET("/logs", h.ShowLogs)
-	groupAdmin.GET("/logs/host/:id", h.ShowHostLogs)
+	groupAdmin.GET("/", h.ListHosts, readHosts)
+	groupAdmin.GET("/hosts/add", h.AddHost, writeHosts)
+	groupAdmin.GET("/hosts/edit/:id", h.EditHost, writeHosts)
+	groupAdmin.GET("/hosts", h.ListHosts, readHosts)
+	groupAdmin.GET("/cnames/add", h.AddCName, writeCNames)
+	groupAdmin.GET("/cnames", h.ListCNames, readCNames)
+	groupAdmin.GET("/records/add", h.AddHostRecord, writeHosts)
+	groupAdmin.GET("/records", h.ListHostRecords, readHosts)
+	groupAdmin.GET("/logs", h.ShowLogs, readLogs)
+	groupAdmin.GET("/logs/host/:id", h.ShowHostLogs, readLogs)
+	groupAdmin.GET("/tokens", h.ListTokens, adminOnly)
+	groupAdmin.GET("/users", h.ListUsers, adminOnly)
+	groupAdmin.GET("/audit", h.ShowAudit, readLogs)
+	groupAdmin.GET("/webhooks", h.ListWebhooks, adminOnly)
 
 	// Rest Routes
-	groupAdmin.POST("/hosts/add", h.CreateHost)
-	groupAdmin.POST("/hosts/edit/:id", h.UpdateHost)
-	groupAdmin.GET("/hosts/delete/:id", h.DeleteHost)
-	//redirect to logout
-	groupAdmin.GET("/logout", func(c echo.Context) error {
-		// either custom url
-		if len(h.LogoutUrl) > 0 {
-			return c.Redirect(302, h.LogoutUrl)
-		}
-		// or standard url
-		return c.Redirect(302, "../")
-	})
-	groupAdmin.POST("/cnames/add", h.CreateCName)
-	groupAdmin.GET("/cnames/delete/:id", h.DeleteCName)
+	groupAdmin.POST("/hosts/add", h.CreateHost, writeHosts)
+	groupAdmin.POST("/hosts/edit/:id", h.UpdateHost, writeHosts)
+	// deletes aren't GET routes, as links and images of other sites could trigger them with the session cookie
+	groupAdmin.DELETE("/hosts/delete/:id", h.DeleteHost, writeHosts)
+	groupAdmin.GET("/logout", h.Logout)
+	groupAdmin.POST("/cnames/add", h.CreateCName, writeCNames)
+	groupAdmin.DELETE("/cnames/delete/:id", h.DeleteCName, writeCNames)
+	groupAdmin.POST("/records/add", h.CreateHostRecord, writeHosts)
+
+	// OpenID Connect login
+	if h.OIDCEnabled() {
+		groupAuth := e.Group("/auth")
+		groupAuth.GET("/login", h.OIDCLogin)
+		groupAuth.GET("/callback", h.OIDCCallback)
+	}
+
+	// Versioned JSON API
+	groupAPI := e.Group("/api/v1")
+	groupAPI.Use(h.TokenAuth)
+	groupAPI.Use(h.SessionAuth)
+	groupAPI.Use(middleware.BasicAuthWithConfig(middleware.BasicAuthConfig{
+		Skipper:   h.SkipAdminAuth,
+		Validator: h.AuthenticateAdmin,
+	}))
+	groupAPI.Use(h.NoAuth)
+
+	groupAPI.GET("/hosts", h.APIListHosts, readHosts)
+	groupAPI.POST("/hosts", h.APICreateHost, writeHosts)
+	groupAPI.GET("/hosts/:id", h.APIGetHost, readHosts)
+	groupAPI.PUT("/hosts/:id", h.APIReplaceHost, writeHosts)
+	groupAPI.PATCH("/hosts/:id", h.APIPatchHost, writeHosts)
+	groupAPI.DELETE("/hosts/:id", h.APIDeleteHost, writeHosts)
+	groupAPI.GET("/cnames", h.APIListCNames, readCNames)
+	groupAPI.POST("/cnames", h.APICreateCName, writeCNames)
+	groupAPI.GET("/cnames/:id", h.APIGetCName, readCNames)
+	groupAPI.PUT("/cnames/:id", h.APIReplaceCName, writeCNames)
+	groupAPI.PATCH("/cnames/:id", h.APIPatchCName, writeCNames)
+	groupAPI.DELETE("/cnames/:id", h.APIDeleteCName, writeCNames)
+	groupAPI.GET("/records", h.APIListHostRecords, readHosts)
+	groupAPI.POST("/records", h.APICreateHostRecord, writeHosts)
+	groupAPI.GET("/records/:id", h.APIGetHostRecord, readHosts)
+	groupAPI.PUT("/records/:id", h.APIReplaceHostRecord, writeHosts)
+	groupAPI.PATCH("/records/:id", h.APIPatchHostRecord, writeHosts)
+	groupAPI.DELETE("/records/:id", h.APIDeleteHostRecord, writeHosts)
+	groupAPI.GET("/logs", h.APIListLogs, readLogs)
+	groupAPI.GET("/logs/:id", h.APIGetLog, readLogs)
+	groupAPI.DELETE("/logs/:id", h.APIDeleteLog, adminOnly)
+	groupAPI.GET("/zones/:zone/records", h.APIListRecords, h.RequireScope(model.ScopeReadOnly))
+	groupAPI.GET("/tokens", h.APIListTokens, adminOnly)
+	groupAPI.POST("/tokens", h.APICreateToken, adminOnly)
+	groupAPI.DELETE("/tokens/:id", h.APIRevokeToken, adminOnly)
+	groupAPI.GET("/users", h.APIListUsers, adminOnly)
+	groupAPI.POST("/users", h.APICreateUser, adminOnly)
+	groupAPI.PATCH("/users/:id", h.APIPatchUser, adminOnly)
+	groupAPI.DELETE("/users/:id", h.APIDeleteUser, adminOnly)
+	groupAPI.GET("/audit", h.APIListAudit, readLogs)
+	groupAPI.GET("/webhooks", h.APIListWebhooks, adminOnly)
+	groupAPI.POST("/webhooks", h.APICreateWebhook, adminOnly)
+	groupAPI.DELETE("/webhooks/:id", h.APIDeleteWebhook, adminOnly)
+	groupAPI.GET("/webhooks/deliveries", h.APIListWebhookDeliveries, adminOnly)
 
 	// dyndns compatible api
 	// (avoid breaking changes and create groups for each update endpoint)
-	updateRoute := e.Group("/update")
-	updateRoute.Use(middleware.BasicAuth(h.AuthenticateUpdate))
-	updateRoute.GET("", h.UpdateIP)
-	nicRoute := e.Group("/nic")
-	nicRoute.Use(middleware.BasicAuth(h.AuthenticateUpdate))
-	nicRoute.GET("/update", h.UpdateIP)
-	v2Route := e.Group("/v2")
-	v2Route.Use(middleware.BasicAuth(h.AuthenticateUpdate))
-	v2Route.GET("/update", h.UpdateIP)
-	v3Route := e.Group("/v3")
-	v3Route.Use(middleware.BasicAuth(h.AuthenticateUpdate))
-	v3Route.GET("/update", h.UpdateIP)
+	for _, server := range updateServers {
+		updateRoute := server.Group("/update")
+		updateRoute.Use(h.UpdateLimit, h.UpdateAuth)
+		updateRoute.GET("", h.UpdateIP)
+		nicRoute := server.Group("/nic")
+		nicRoute.Use(h.UpdateLimit, h.UpdateAuth)
+		nicRoute.GET("/update", h.UpdateIP)
+		v2Route := server.Group("/v2")
+		v2Route.Use(h.UpdateLimit, h.UpdateAuth)
+		v2Route.GET("/update", h.UpdateIP)
+		v3Route := server.Group("/v3")
+		v3Route.Use(h.UpdateLimit, h.UpdateAuth)
+		v3Route.GET("/update", h.UpdateIP)
+
+		// ACME DNS-01 challenges of hosts for lego httpreq and acme-dns clients
+		acmeRoute := server.Group("/acme")
+		acmeRoute.Use(h.ChallengeLimit)
+		acmeRoute.POST("/present", h.PresentChallenge, middleware.BasicAuth(h.AuthenticateUpdate))
+		acmeRoute.POST("/cleanup", h.CleanupChallenge, middleware.BasicAuth(h.AuthenticateUpdate))
+		acmeRoute.POST("/update", h.UpdateChallenge)
+	}
+
+	// prometheus metrics
+	metricsRoute := e.Group("/metrics")
+	if h.Config.MetricsLogin != "" {
+		metricsRoute.Use(middleware.BasicAuth(h.AuthenticateMetrics))
+	}
+	metricsRoute.GET("", echo.WrapHandler(metrics.NewHandler(h.DB)))
 
 	// health-check
-	e.GET("/ping", func(c echo.Context) error {
+	ping := func(c echo.Context) error {
 		u := &handler.Error{
 			Message: "OK",
 		}
 		return c.JSON(http.StatusOK, u)
-	})
+	}
+	e.GET("/ping", ping)
+
+	// Start servers
+	servers := []*echo.Echo{e}
+	if h.ACME != nil {
+		e.TLSServer.Addr = h.Config.Listen
+		e.TLSServer.TLSConfig = &tls.Config{GetCertificate: h.ACME.GetCertificate}
+		go start(e, e.TLSServer)
+	} else {
+		e.Server.Addr = h.Config.Listen
+		go start(e, e.Server)
+	}
+	if plain != nil {
+		plain.GET("/ping", ping)
+		plain.Server.Addr = h.Config.UpdateListen
+		servers = append(servers, plain)
+		go start(plain, plain.Server)
+	}
+
+	<-ctx.Done()
+	log.Info("Shutting down")
+
+	// Drain running requests before the database is closed
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, server := range servers {
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error("Error shutting down server: ", err)
+		}
+	}
+
+	if h.DNSServer != nil {
+		if err := h.DNSServer.Shutdown(); err != nil {
+			log.Error("Error shutting down name server: ", err)
+		}
+	}
+
+	jobs.Stop()
 
-	// Start server
-	e.Logger.Fatal(e.Start(":8080"))
+	if err := h.Close(); err != nil {
+		log.Error("Error closing database: ", err)
+	}
+}
+
+// start serves e with server until it is shut down.
+func start(e *echo.Echo, server *http.Server) {
+	if err := e.StartServer(server); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		e.Logger.Fatal(err)
+	}
 }
@@ -0,0 +1,84 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/nswrapper"
+)
+
+// Backend measures the duration of all requests to a DNS backend.
+type Backend struct {
+	Backend nswrapper.DNSBackend
+	Name    string
+}
+
+// InstrumentBackend wraps backend, so its requests are measured with the label backend=name.
+func InstrumentBackend(backend nswrapper.DNSBackend, name string) *Backend {
+	return &Backend{Backend: backend, Name: name}
+}
+
+// UpdateRecord implements nswrapper.DNSBackend.
+func (b *Backend) UpdateRecord(hostname string, target string, addrType string, zone string, ttl int, enableWildcard bool) error {
+	return b.measure("update", func() error {
+		return b.Backend.UpdateRecord(hostname, target, addrType, zone, ttl, enableWildcard)
+	})
+}
+
+// DeleteRecord implements nswrapper.DNSBackend.
+func (b *Backend) DeleteRecord(hostname string, zone string, enableWildcard bool) error {
+	return b.measure("delete", func() error {
+		return b.Backend.DeleteRecord(hostname, zone, enableWildcard)
+	})
+}
+
+// DeleteRecordType implements nswrapper.DNSBackend.
+func (b *Backend) DeleteRecordType(hostname string, addrType string, zone string, enableWildcard bool) error {
+	return b.measure("delete", func() error {
+		return b.Backend.DeleteRecordType(hostname, addrType, zone, enableWildcard)
+	})
+}
+
+// AddRecord implements nswrapper.DNSBackend.
+func (b *Backend) AddRecord(hostname string, target string, addrType string, zone string, ttl int) error {
+	return b.measure("add", func() error {
+		return b.Backend.AddRecord(hostname, target, addrType, zone, ttl)
+	})
+}
+
+// UpdateRecordSet implements nswrapper.DNSBackend.
+func (b *Backend) UpdateRecordSet(hostname string, targets []string, addrType string, zone string, ttl int) error {
+	return b.measure("update", func() error {
+		return b.Backend.UpdateRecordSet(hostname, targets, addrType, zone, ttl)
+	})
+}
+
+// RemoveRecord implements nswrapper.DNSBackend.
+func (b *Backend) RemoveRecord(hostname string, target string, addrType string, zone string) error {
+	return b.measure("remove", func() error {
+		return b.Backend.RemoveRecord(hostname, target, addrType, zone)
+	})
+}
+
+// ListRecords implements nswrapper.DNSBackend.
+func (b *Backend) ListRecords(zone string) (records []nswrapper.Record, err error) {
+	err = b.measure("list", func() error {
+		records, err = b.Backend.ListRecords(zone)
+		return err
+	})
+
+	return records, err
+}
+
+// measure observes the duration and status of request as operation.
+func (b *Backend) measure(operation string, request func() error) error {
+	start := time.Now()
+	err := request()
+
+	status := "ok"
+	if err != nil {
+		status = "error"
+	}
+	dnsDuration.WithLabelValues(b.Name, operation, status).Observe(time.Since(start).Seconds())
+
+	return err
+}
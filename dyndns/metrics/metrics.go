@@ -0,0 +1,112 @@
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/gommon/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"gorm.io/gorm"
+)
+
+var (
+	updates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "ddns",
+		Name:      "updates_total",
+		Help:      "Update requests by dyndns2 result code.",
+	}, []string{"result"})
+
+	dnsDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "ddns",
+		Name:      "dns_request_duration_seconds",
+		Help:      "Duration of the requests to the DNS backend by backend, operation and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"backend", "operation", "status"})
+
+	hostLastUpdate = prometheus.NewDesc("ddns_host_last_update_timestamp_seconds", "Time of the last address change of a host.", []string{"host"}, nil)
+	hostLastSeen   = prometheus.NewDesc("ddns_host_last_seen_timestamp_seconds", "Time of the last update request of a host.", []string{"host"}, nil)
+	hostStale      = prometheus.NewDesc("ddns_host_stale", "Whether the update of a host is overdue.", []string{"host"}, nil)
+	hostCount      = prometheus.NewDesc("ddns_hosts", "Number of hosts.", nil, nil)
+	cnameCount     = prometheus.NewDesc("ddns_cnames", "Number of cnames.", nil, nil)
+	logCount       = prometheus.NewDesc("ddns_log_entries", "Number of log entries.", nil, nil)
+)
+
+// CountUpdate counts an update answered with result, e.g. "good 1.2.3.4" or "badauth".
+func CountUpdate(result string) {
+	if code, _, _ := strings.Cut(result, " "); code != "" {
+		updates.WithLabelValues(code).Inc()
+	}
+}
+
+// NewHandler returns the http handler exposing the update, DNS backend, process and database metrics.
+func NewHandler(db *gorm.DB) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		updates,
+		dnsDuration,
+		&dbCollector{db: db},
+	)
+
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// dbCollector reads the host, cname and log metrics from the database on each scrape.
+type dbCollector struct {
+	db *gorm.DB
+}
+
+// Describe implements prometheus.Collector.
+func (d *dbCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hostLastUpdate
+	ch <- hostLastSeen
+	ch <- hostStale
+	ch <- hostCount
+	ch <- cnameCount
+	ch <- logCount
+}
+
+// Collect implements prometheus.Collector.
+func (d *dbCollector) Collect(ch chan<- prometheus.Metric) {
+	hosts := []model.Host{}
+	if err := d.db.Select("hostname", "domain", "last_update", "last_seen", "stale").Find(&hosts).Error; err != nil {
+		log.Error("Error collecting host metrics: ", err)
+		return
+	}
+
+	for _, host := range hosts {
+		name := host.Hostname + "." + host.Domain
+		ch <- prometheus.MustNewConstMetric(hostLastUpdate, prometheus.GaugeValue, timestamp(host.LastUpdate), name)
+		ch <- prometheus.MustNewConstMetric(hostLastSeen, prometheus.GaugeValue, timestamp(host.LastSeen), name)
+
+		var stale float64
+		if host.Stale {
+			stale = 1
+		}
+		ch <- prometheus.MustNewConstMetric(hostStale, prometheus.GaugeValue, stale, name)
+	}
+	ch <- prometheus.MustNewConstMetric(hostCount, prometheus.GaugeValue, float64(len(hosts)))
+
+	for desc, value := range map[*prometheus.Desc]interface{}{cnameCount: &model.CName{}, logCount: &model.Log{}} {
+		var count int64
+		if err := d.db.Model(value).Count(&count).Error; err != nil {
+			log.Error("Error collecting metrics: ", err)
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(count))
+	}
+}
+
+// timestamp returns t in unix seconds, or 0 if t is not set.
+func timestamp(t time.Time) float64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return float64(t.Unix())
+}
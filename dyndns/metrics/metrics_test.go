@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/benjaminbear/docker-ddns-server/dyndns/nswrapper"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// failingBackend fails all requests.
+type failingBackend struct{}
+
+func (failingBackend) UpdateRecord(hostname string, target string, addrType string, zone string, ttl int, enableWildcard bool) error {
+	return errors.New("refused")
+}
+
+func (failingBackend) DeleteRecord(hostname string, zone string, enableWildcard bool) error {
+	return nil
+}
+
+func (failingBackend) DeleteRecordType(hostname string, addrType string, zone string, enableWildcard bool) error {
+	return nil
+}
+
+func (failingBackend) AddRecord(hostname string, target string, addrType string, zone string, ttl int) error {
+	return nil
+}
+
+func (failingBackend) UpdateRecordSet(hostname string, targets []string, addrType string, zone string, ttl int) error {
+	return nil
+}
+
+func (failingBackend) RemoveRecord(hostname string, target string, addrType string, zone string) error {
+	return nil
+}
+
+func (failingBackend) ListRecords(zone string) ([]nswrapper.Record, error) {
+	return nil, nil
+}
+
+func TestHandlerToExposeMetrics(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err = db.AutoMigrate(&model.Host{}, &model.CName{}, &model.Log{}); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	db.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", LastUpdate: time.Unix(1700000000, 0), Ttl: 60, UserName: "bloguser", Password: "blogpassword"})
+
+	CountUpdate("good 1.2.3.4")
+	CountUpdate("badauth")
+	backend := InstrumentBackend(failingBackend{}, "test")
+	if err = backend.UpdateRecord("blog", "1.2.3.4", "A", "dyndns.example.com", 60, false); err == nil {
+		t.Fatalf("Expected the error of the backend to be returned")
+	}
+
+	rec := httptest.NewRecorder()
+	NewHandler(db).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body := rec.Body.String()
+
+	for _, expected := range []string{
+		`ddns_updates_total{result="good"} 1`,
+		`ddns_updates_total{result="badauth"} 1`,
+		`ddns_dns_request_duration_seconds_count{backend="test",operation="update",status="error"} 1`,
+		`ddns_host_last_update_timestamp_seconds{host="blog.dyndns.example.com"} 1.7e+09`,
+		`ddns_hosts 1`,
+		`ddns_cnames 0`,
+		`ddns_log_entries 0`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Fatalf("Expected metric %s but got %s", expected, body)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package migrate
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"gorm.io/gorm"
+)
+
+// Migration is a single versioned change of the database schema or its data.
+// Migrations without Down can't be rolled back.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// SchemaVersion records an applied migration.
+type SchemaVersion struct {
+	Version   int `gorm:"primaryKey;autoIncrement:false"`
+	Name      string
+	AppliedAt time.Time
+}
+
+// TableName keeps the version table name singular.
+func (SchemaVersion) TableName() string {
+	return "schema_version"
+}
+
+// Up applies all pending migrations in order.
+func Up(db *gorm.DB) error {
+	return up(db, migrations)
+}
+
+// Down rolls back all applied migrations above version, newest first.
+func Down(db *gorm.DB, version int) error {
+	return down(db, migrations, version)
+}
+
+// Version returns the version of the newest applied migration, zero for an empty database.
+func Version(db *gorm.DB) (int, error) {
+	if err := db.AutoMigrate(&SchemaVersion{}); err != nil {
+		return 0, err
+	}
+
+	version := 0
+	err := db.Model(&SchemaVersion{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+
+	return version, err
+}
+
+// Pending returns the migrations which haven't been applied yet.
+func Pending(db *gorm.DB) ([]Migration, error) {
+	return pending(db, migrations)
+}
+
+// Latest returns the version of the newest known migration.
+func Latest() int {
+	return migrations[len(migrations)-1].Version
+}
+
+func pending(db *gorm.DB, list []Migration) ([]Migration, error) {
+	if err := db.AutoMigrate(&SchemaVersion{}); err != nil {
+		return nil, err
+	}
+
+	applied := []int{}
+	if err := db.Model(&SchemaVersion{}).Pluck("version", &applied).Error; err != nil {
+		return nil, err
+	}
+
+	done := map[int]bool{}
+	for _, version := range applied {
+		done[version] = true
+	}
+
+	result := []Migration{}
+	for _, m := range list {
+		if !done[m.Version] {
+			result = append(result, m)
+		}
+	}
+
+	return result, nil
+}
+
+// up runs every pending migration of list together with its version record in a transaction.
+// MySQL commits schema changes implicitly, so failed migrations may be applied partially there.
+func up(db *gorm.DB, list []Migration) error {
+	todo, err := pending(db, list)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range todo {
+		log.Info("Applying migration ", m.Version, ": ", m.Name)
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+
+			return tx.Create(&SchemaVersion{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// down rolls back the applied migrations of list above version.
+// Nothing is rolled back, if any of them is irreversible.
+func down(db *gorm.DB, list []Migration, version int) error {
+	todo, err := pending(db, list)
+	if err != nil {
+		return err
+	}
+
+	skip := map[int]bool{}
+	for _, m := range todo {
+		skip[m.Version] = true
+	}
+
+	todo = []Migration{}
+	for i := len(list) - 1; i >= 0; i-- {
+		m := list[i]
+		if m.Version <= version || skip[m.Version] {
+			continue
+		}
+		if m.Down == nil {
+			return fmt.Errorf("migration %d (%s) can't be rolled back", m.Version, m.Name)
+		}
+		todo = append(todo, m)
+	}
+
+	for _, m := range todo {
+		log.Info("Rolling back migration ", m.Version, ": ", m.Name)
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+
+			return tx.Delete(&SchemaVersion{Version: m.Version}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package migrate
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	return db
+}
+
+func TestMigrationsToBeOrdered(t *testing.T) {
+	for i := 1; i < len(migrations); i++ {
+		if migrations[i].Version <= migrations[i-1].Version {
+			t.Fatalf("Expected migration %d to follow %d", migrations[i].Version, migrations[i-1].Version)
+		}
+	}
+}
+
+func TestUpToApplyPendingMigrationsOnce(t *testing.T) {
+	db := newTestDB(t)
+
+	if err := Up(db); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if err := Up(db); err != nil {
+		t.Fatalf("Expected second run to succeed but got %v", err)
+	}
+
+	if version, _ := Version(db); version != Latest() {
+		t.Fatalf("Expected version %d but got %d", Latest(), version)
+	}
+	if todo, _ := Pending(db); len(todo) != 0 {
+		t.Fatalf("Expected no pending migrations but got %d", len(todo))
+	}
+
+	for _, index := range []string{"idx_logs_host_created", "idx_logs_created_at"} {
+		if !db.Migrator().HasIndex(&model.Log{}, index) {
+			t.Fatalf("Expected index %s", index)
+		}
+	}
+
+	db.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ttl: 60, Password: "blogpassword"})
+	if err := db.Create(&model.Host{Hostname: "blog", Domain: "dyndns.example.com", Ttl: 60, Password: "blogpassword"}).Error; err == nil {
+		t.Fatal("Expected duplicate host to be rejected")
+	}
+}
+
+func TestUpToCreateColumnsOfAllModels(t *testing.T) {
+	db := newTestDB(t)
+	if err := Up(db); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	for _, value := range []interface{}{&model.Host{}, &model.CName{}, &model.Log{}, &model.Token{}, &model.User{}, &model.Audit{}, &model.Session{}, &model.Webhook{}, &model.WebhookDelivery{}, &model.Record{}} {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(value); err != nil {
+			t.Fatalf("Expected no error but got %v", err)
+		}
+
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !db.Migrator().HasColumn(value, field.DBName) {
+				t.Fatalf("Expected column %s.%s, add a migration for it", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+}
+
+func TestUpToCreateNoForeignKeys(t *testing.T) {
+	db := newTestDB(t)
+	db.Exec("PRAGMA foreign_keys = ON")
+	if err := Up(db); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	// rows of deleted hosts and users are left by the delete paths of older versions
+	db.Exec("INSERT INTO users (user_name, password, role) VALUES ('tenant', 'x', 'operator')")
+	db.Exec("INSERT INTO hosts (hostname, domain, ttl, owner_id) VALUES ('blog', 'dyndns.example.com', 60, 1)")
+	db.Exec("INSERT INTO logs (host_id, message) VALUES (1, 'update')")
+	db.Exec("INSERT INTO c_names (hostname, target_id, ttl) VALUES ('www', 1, 60)")
+	db.Exec("INSERT INTO records (host_id, type, value, ttl) VALUES (1, 'TXT', 'text', 60)")
+
+	for _, table := range []string{"users", "hosts"} {
+		if err := db.Exec("DELETE FROM " + table).Error; err != nil {
+			t.Fatalf("Expected %s to be deleted despite dependent rows but got %v", table, err)
+		}
+	}
+
+	for _, table := range []string{"logs", "c_names", "records"} {
+		rows := []struct{ Table string }{}
+		db.Raw(`SELECT "table" FROM pragma_foreign_key_list(?)`, table).Scan(&rows)
+		if len(rows) != 0 {
+			t.Fatalf("Expected no foreign keys of %s but got %v", table, rows)
+		}
+	}
+}
+
+func TestUpToStopAtFailingMigration(t *testing.T) {
+	db := newTestDB(t)
+	list := []Migration{
+		{Version: 1, Name: "ok", Up: func(tx *gorm.DB) error { return nil }},
+		{Version: 2, Name: "fail", Up: func(tx *gorm.DB) error { return errors.New("fail") }},
+		{Version: 3, Name: "never", Up: func(tx *gorm.DB) error { return nil }},
+	}
+
+	if err := up(db, list); err == nil {
+		t.Fatal("Expected error of migration 2")
+	}
+
+	if todo, _ := pending(db, list); len(todo) != 2 || todo[0].Version != 2 {
+		t.Fatalf("Expected migrations 2 and 3 to be pending but got %+v", todo)
+	}
+}
+
+func TestDownToRollBackReversibleMigrations(t *testing.T) {
+	db := newTestDB(t)
+	if err := Up(db); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	if err := Down(db, 3); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	if version, _ := Version(db); version != 3 {
+		t.Fatalf("Expected version 3 but got %d", version)
+	}
+	if db.Migrator().HasIndex(&model.Host{}, "idx_host_domain") || db.Migrator().HasIndex(&model.Log{}, "idx_logs_created_at") {
+		t.Fatal("Expected indexes to be dropped")
+	}
+
+	if err := Down(db, 0); err == nil {
+		t.Fatal("Expected irreversible migration to fail")
+	}
+	if version, _ := Version(db); version != 3 {
+		t.Fatalf("Expected nothing to be rolled back but got version %d", version)
+	}
+}
+
+func TestCreateHostIndexToRejectDuplicates(t *testing.T) {
+	db := newTestDB(t)
+	if err := createTables(db); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	db.Exec("INSERT INTO hosts (hostname, domain, ttl) VALUES ('blog', 'dyndns.example.com', 60), ('blog', 'dyndns.example.com', 60)")
+
+	if err := createHostIndex(db); err == nil {
+		t.Fatal("Expected duplicate hosts to be reported")
+	}
+}
+
+// legacyHost is a host from before dual-stack support.
+type legacyHost struct {
+	hostV1
+	Ip string
+}
+
+func (legacyHost) TableName() string {
+	return "hosts"
+}
+
+func TestSplitHostIPsToSplitAddressFamilies(t *testing.T) {
+	db := newTestDB(t)
+	if err := createTables(db); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	db.Migrator().AddColumn(&legacyHost{}, "Ip")
+	db.Exec("INSERT INTO hosts (hostname, domain, ttl, user_name, password, ip) VALUES ('a', 'dyndns.example.com', 60, 'a', 'a', '1.2.3.4'), ('b', 'dyndns.example.com', 60, 'b', 'b', '2001:db8::1')")
+
+	if err := splitHostIPs(db); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	hosts := []model.Host{}
+	db.Order("hostname").Find(&hosts)
+	if len(hosts) != 2 || hosts[0].Ipv4 != "1.2.3.4" || hosts[0].Ipv6 != "" || hosts[1].Ipv4 != "" || hosts[1].Ipv6 != "2001:db8::1" {
+		t.Fatalf("Expected addresses to be split by family but got %+v", hosts)
+	}
+
+	if db.Migrator().HasColumn(&model.Host{}, "ip") {
+		t.Fatal("Expected column ip to be dropped")
+	}
+}
+
+func TestHashPasswordsToHashPlaintextRows(t *testing.T) {
+	db := newTestDB(t)
+	if err := createTables(db); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	db.Exec("INSERT INTO hosts (hostname, domain, ttl, user_name, password) VALUES ('blog', 'dyndns.example.com', 60, 'bloguser', 'blogpassword')")
+
+	if err := hashPasswords(db); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	host := &model.Host{}
+	db.First(host)
+	if !model.IsPasswordHash(host.Password) || !host.CheckPassword("blogpassword") {
+		t.Fatalf("Expected plaintext password to be hashed but got %s", host.Password)
+	}
+}
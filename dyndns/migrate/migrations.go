@@ -0,0 +1,141 @@
+package migrate
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/gommon/log"
+	"gorm.io/gorm"
+)
+
+// migrations are applied in this order, versions must only ever be appended.
+// They work on the table snapshots of schema.go, never on the models.
+var migrations = []Migration{
+	{Version: 1, Name: "create tables", Up: createTables},
+	{Version: 2, Name: "split host ips", Up: splitHostIPs},
+	{Version: 3, Name: "hash update passwords", Up: hashPasswords},
+	{Version: 4, Name: "unique host names", Up: createHostIndex, Down: dropIndexes(&hostV1{}, "idx_host_domain")},
+	{Version: 5, Name: "log indexes", Up: createLogIndexes, Down: dropIndexes(&logV1{}, "idx_logs_host_created", "idx_logs_created_at")},
+	{Version: 6, Name: "create records", Up: createRecords, Down: dropRecords},
+}
+
+// createTables creates the tables and columns which were maintained by AutoMigrate before.
+func createTables(tx *gorm.DB) error {
+	return tx.AutoMigrate(&hostV1{}, &cnameV1{}, &logV1{}, &tokenV1{}, &userV1{}, &auditV1{}, &sessionV1{}, &webhookV1{}, &webhookDeliveryV1{})
+}
+
+// splitHostIPs moves the single ip of hosts from before dual-stack support
+// to the IPv4 or IPv6 address and drops the old column.
+func splitHostIPs(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&hostV1{}, "ip") {
+		return nil
+	}
+
+	err := tx.Model(&hostV1{}).Where("ip <> ? AND ip NOT LIKE ?", "", "%:%").
+		Updates(map[string]interface{}{"ipv4": gorm.Expr("ip"), "ipv4_last_update": gorm.Expr("last_update")}).Error
+	if err != nil {
+		return err
+	}
+
+	err = tx.Model(&hostV1{}).Where("ip LIKE ?", "%:%").
+		Updates(map[string]interface{}{"ipv6": gorm.Expr("ip"), "ipv6_last_update": gorm.Expr("last_update")}).Error
+	if err != nil {
+		return err
+	}
+
+	return tx.Migrator().DropColumn(&hostV1{}, "ip")
+}
+
+// hashPasswords replaces plaintext update passwords of existing hosts by their hash.
+// Only here passwords looking like a hash are taken as already hashed.
+func hashPasswords(tx *gorm.DB) error {
+	hosts := []hostV1{}
+	if err := tx.Find(&hosts).Error; err != nil {
+		return err
+	}
+
+	for _, host := range hosts {
+		if host.Password == "" || model.IsPasswordHash(host.Password) {
+			continue
+		}
+
+		log.Info("Hashing update password of host ", host.Hostname, ".", host.Domain)
+		hash, err := model.HashPassword(host.Password)
+		if err != nil {
+			return err
+		}
+		if err = tx.Model(&host).UpdateColumn("password", hash).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createHostIndex makes hostname and domain unique together,
+// the gorm v1 tag meant for it was never applied.
+func createHostIndex(tx *gorm.DB) error {
+	if tx.Migrator().HasIndex(&hostV1{}, "idx_host_domain") {
+		return nil
+	}
+
+	rows := []struct{ Hostname, Domain string }{}
+	err := tx.Model(&hostV1{}).Select("hostname, domain").Group("hostname, domain").Having("COUNT(*) > 1").Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+	if len(rows) > 0 {
+		duplicates := []string{}
+		for _, row := range rows {
+			duplicates = append(duplicates, row.Hostname+"."+row.Domain)
+		}
+		return fmt.Errorf("hosts are not unique, remove the duplicates first: %s", strings.Join(duplicates, ", "))
+	}
+
+	return tx.Exec("CREATE UNIQUE INDEX idx_host_domain ON hosts (hostname, domain)").Error
+}
+
+// createLogIndexes adds the indexes used to list and prune log entries.
+func createLogIndexes(tx *gorm.DB) error {
+	indexes := map[string]string{
+		"idx_logs_host_created": "CREATE INDEX idx_logs_host_created ON logs (host_id, created_at)",
+		"idx_logs_created_at":   "CREATE INDEX idx_logs_created_at ON logs (created_at)",
+	}
+
+	for name, ddl := range indexes {
+		if tx.Migrator().HasIndex(&logV1{}, name) {
+			continue
+		}
+		if err := tx.Exec(ddl).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// dropIndexes returns a migration dropping the indexes names of the table of value.
+func dropIndexes(value interface{}, names ...string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		for _, name := range names {
+			if !tx.Migrator().HasIndex(value, name) {
+				continue
+			}
+			if err := tx.Migrator().DropIndex(value, name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// createRecords creates the table of the TXT, MX, SRV and CAA records of hosts.
+func createRecords(tx *gorm.DB) error {
+	return tx.AutoMigrate(&recordV6{})
+}
+
+func dropRecords(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&recordV6{})
+}
@@ -0,0 +1,168 @@
+package migrate
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The tables are snapshots of the models at the version of the migration creating them.
+// They must never change, later changes of the models need a new migration.
+// They leave out the associations of the models, so no foreign keys are created:
+// the tables created by gorm v1 had none and still contain logs and cnames of deleted hosts.
+
+// hostV1 is the hosts table of migration 1.
+type hostV1 struct {
+	gorm.Model
+	Hostname       string `gorm:"size:255;not null"`
+	Domain         string `gorm:"size:255;not null"`
+	Ipv4           string
+	Ipv6           string
+	Ttl            int
+	LastUpdate     time.Time
+	Ipv4LastUpdate time.Time
+	Ipv6LastUpdate time.Time
+	UserName       string
+	Password       string
+	Blocked        bool
+	UpdateInterval int
+	LastSeen       time.Time
+	Stale          bool
+	OwnerID        uint `gorm:"index"`
+}
+
+func (hostV1) TableName() string {
+	return "hosts"
+}
+
+// cnameV1 is the c_names table of migration 1.
+type cnameV1 struct {
+	gorm.Model
+	Hostname string `gorm:"not null"`
+	TargetID uint
+	Ttl      int
+}
+
+func (cnameV1) TableName() string {
+	return "c_names"
+}
+
+// logV1 is the logs table of migration 1.
+type logV1 struct {
+	gorm.Model
+	Status    bool
+	Unchanged bool
+	Message   string
+	HostID    uint
+	SentIP    string
+	CallerIP  string
+	TimeStamp time.Time
+	UserAgent string
+}
+
+func (logV1) TableName() string {
+	return "logs"
+}
+
+// tokenV1 is the tokens table of migration 1.
+type tokenV1 struct {
+	gorm.Model
+	Name     string `gorm:"unique;size:255;not null"`
+	Hash     string `gorm:"unique;size:255;not null"`
+	Prefix   string
+	Scopes   string
+	LastUsed time.Time
+}
+
+func (tokenV1) TableName() string {
+	return "tokens"
+}
+
+// userV1 is the users table of migration 1.
+type userV1 struct {
+	gorm.Model
+	UserName string `gorm:"unique;size:255;not null"`
+	Password string
+	Role     string
+	Tenant   bool
+	Domains  string
+}
+
+func (userV1) TableName() string {
+	return "users"
+}
+
+// auditV1 is the audits table of migration 1.
+type auditV1 struct {
+	gorm.Model
+	UserName string `gorm:"index;size:255"`
+	Action   string
+	Object   string
+}
+
+func (auditV1) TableName() string {
+	return "audits"
+}
+
+// sessionV1 is the sessions table of migration 1.
+type sessionV1 struct {
+	gorm.Model
+	Hash      string `gorm:"unique;size:255;not null"`
+	UserName  string
+	Role      string
+	IDToken   string
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+func (sessionV1) TableName() string {
+	return "sessions"
+}
+
+// webhookV1 is the webhooks table of migration 1.
+type webhookV1 struct {
+	gorm.Model
+	URL    string `gorm:"not null"`
+	Secret string `gorm:"not null"`
+	Events string
+	HostID uint `gorm:"index"`
+}
+
+func (webhookV1) TableName() string {
+	return "webhooks"
+}
+
+// webhookDeliveryV1 is the webhook_deliveries table of migration 1.
+type webhookDeliveryV1 struct {
+	gorm.Model
+	WebhookID  uint `gorm:"index"`
+	Event      string
+	Host       string
+	Payload    string
+	Attempts   int
+	StatusCode int
+	Error      string
+	Success    bool
+}
+
+func (webhookDeliveryV1) TableName() string {
+	return "webhook_deliveries"
+}
+
+// recordV6 is the records table of migration 6.
+type recordV6 struct {
+	gorm.Model
+	HostID   uint   `gorm:"index"`
+	Type     string `gorm:"size:8;not null"`
+	Name     string
+	Value    string `gorm:"not null"`
+	Priority int
+	Weight   int
+	Port     int
+	Flag     int
+	Tag      string
+	Ttl      int
+}
+
+func (recordV6) TableName() string {
+	return "records"
+}
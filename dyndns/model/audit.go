@@ -0,0 +1,11 @@
+package model
+
+import "gorm.io/gorm"
+
+// Audit records an admin action together with the admin who did it.
+type Audit struct {
+	gorm.Model
+	UserName string `gorm:"index;size:255"`
+	Action   string
+	Object   string
+}
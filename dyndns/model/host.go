@@ -3,34 +3,127 @@ package model
 import (
 	"time"
 
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
 // Host is a dns host entry.
+// The IPv4 and IPv6 address are maintained independently as A and AAAA record.
+// Several hosts may share the same update credentials.
+// Hostname and domain are unique together, the index is maintained by the migrate package.
 type Host struct {
 	gorm.Model
-	Hostname   string    `gorm:"unique_index:idx_host_domain;not null" form:"hostname" validate:"required,hostname"`
-	Domain     string    `gorm:"unique_index:idx_host_domain;not null" form:"domain" validate:"required,fqdn"`
-	Ip         string    `form:"ip" validate:"omitempty,ipv4|ipv6"`
-	Ttl        int       `form:"ttl" validate:"required,min=20,max=86400"`
-	LastUpdate time.Time `form:"lastupdate"`
-	UserName   string    `gorm:"unique" form:"username" validate:"min=3"`
-	Password   string    `form:"password" validate:"min=8"`
+	Hostname       string    `gorm:"size:255;not null" form:"hostname" validate:"required,hostname"`
+	Domain         string    `gorm:"size:255;not null" form:"domain" validate:"required,fqdn"`
+	Ipv4           string    `form:"ipv4" validate:"omitempty,ipv4"`
+	Ipv6           string    `form:"ipv6" validate:"omitempty,ipv6"`
+	Ttl            int       `form:"ttl" validate:"required,min=20,max=86400"`
+	LastUpdate     time.Time `form:"lastupdate"`
+	Ipv4LastUpdate time.Time `form:"-"`
+	Ipv6LastUpdate time.Time `form:"-"`
+	UserName       string    `form:"username" validate:"min=3"`
+	Password       string    `form:"password" validate:"min=8"`
+	// Blocked hosts are answered with "abuse" on updates.
+	Blocked bool `form:"blocked"`
+	// UpdateInterval is the expected update interval in minutes, hosts not seen within are stale.
+	// Zero disables the stale detection.
+	UpdateInterval int       `form:"update_interval" validate:"min=0"`
+	LastSeen       time.Time `form:"-"`
+	Stale          bool      `form:"-"`
+	// OwnerID is the admin user owning the host, if any.
+	OwnerID uint `gorm:"index" form:"-"`
+
+	storedPassword string
+}
+
+// AfterFind remembers the stored password hash, so saving the host doesn't hash it again.
+func (h *Host) AfterFind(tx *gorm.DB) error {
+	h.storedPassword = h.Password
+
+	return nil
+}
+
+// BeforeSave hashes the password, if a new one has been set.
+func (h *Host) BeforeSave(tx *gorm.DB) error {
+	hash, err := hashNewPassword(h.Password, h.storedPassword)
+	if err != nil {
+		return err
+	}
+	h.Password, h.storedPassword = hash, hash
+
+	return nil
+}
+
+// CheckPassword compares password with the stored password hash in constant time.
+func (h *Host) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(h.Password), []byte(password)) == nil
 }
 
 // UpdateHost updates all fields of a host entry
 // and sets a new LastUpdate date.
+// The password is only replaced if a new one is given.
 func (h *Host) UpdateHost(updateHost *Host) (updateRecord bool) {
-	updateRecord = false
-	if h.Ip != updateHost.Ip || h.Ttl != updateHost.Ttl {
+	now := time.Now()
+	updateRecord = h.Ttl != updateHost.Ttl
+	if h.SetIPv4(updateHost.Ipv4, now) {
+		updateRecord = true
+	}
+	if h.SetIPv6(updateHost.Ipv6, now) {
 		updateRecord = true
-		h.LastUpdate = time.Now()
+	}
+	if updateRecord {
+		h.LastUpdate = now
 	}
 
-	h.Ip = updateHost.Ip
 	h.Ttl = updateHost.Ttl
 	h.UserName = updateHost.UserName
-	h.Password = updateHost.Password
+	h.Blocked = updateHost.Blocked
+	if h.UpdateInterval != updateHost.UpdateInterval {
+		h.UpdateInterval = updateHost.UpdateInterval
+		h.Stale = false
+	}
+	if updateHost.Password != "" {
+		h.Password = updateHost.Password
+	}
 
 	return
 }
+
+// SetIPv4 sets the IPv4 address and its update time, if it changed.
+func (h *Host) SetIPv4(ip string, now time.Time) (changed bool) {
+	if h.Ipv4 == ip {
+		return false
+	}
+
+	h.Ipv4 = ip
+	h.Ipv4LastUpdate = now
+
+	return true
+}
+
+// SetIPv6 sets the IPv6 address and its update time, if it changed.
+func (h *Host) SetIPv6(ip string, now time.Time) (changed bool) {
+	if h.Ipv6 == ip {
+		return false
+	}
+
+	h.Ipv6 = ip
+	h.Ipv6LastUpdate = now
+
+	return true
+}
+
+// IsStale reports whether an update of the host is overdue at now.
+// Hosts, which have never been seen, are measured from their creation.
+func (h *Host) IsStale(now time.Time) bool {
+	if h.UpdateInterval <= 0 {
+		return false
+	}
+
+	lastSeen := h.LastSeen
+	if lastSeen.IsZero() {
+		lastSeen = h.CreatedAt
+	}
+
+	return now.Sub(lastSeen) > time.Duration(h.UpdateInterval)*time.Minute
+}
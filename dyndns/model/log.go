@@ -7,9 +7,11 @@ import (
 )
 
 // Log defines a log entry.
+// Unchanged marks successful updates, which didn't change the address and skipped the DNS server.
 type Log struct {
 	gorm.Model
 	Status    bool
+	Unchanged bool
 	Message   string
 	Host      Host
 	HostID    uint
@@ -0,0 +1,32 @@
+package model
+
+import "golang.org/x/crypto/bcrypt"
+
+// PasswordCost is the bcrypt cost new passwords are hashed with.
+var PasswordCost = bcrypt.DefaultCost
+
+// IsPasswordHash tells if password is already a bcrypt hash.
+func IsPasswordHash(password string) bool {
+	_, err := bcrypt.Cost([]byte(password))
+	return err == nil
+}
+
+// HashPassword returns the bcrypt hash of a plaintext password.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+// hashNewPassword hashes password, unless it is empty or still the hash stored in the database.
+// A new password is always taken as plaintext, even if it looks like a hash.
+func hashNewPassword(password string, stored string) (string, error) {
+	if password == "" || password == stored {
+		return password, nil
+	}
+
+	return HashPassword(password)
+}
@@ -0,0 +1,112 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Record types which can be added to a host besides its address records.
+const (
+	RecordTXT = "TXT"
+	RecordMX  = "MX"
+	RecordSRV = "SRV"
+	RecordCAA = "CAA"
+)
+
+var (
+	domainName = regexp.MustCompile(`^(?i)[a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9_])?(\.[a-z0-9_]([a-z0-9_-]{0,61}[a-z0-9_])?)*\.?$`)
+	srvName    = regexp.MustCompile(`^(?i)_[a-z0-9-]+\._(tcp|udp|tls|sctp)$`)
+)
+
+// Record is an additional dns record of a host.
+// It is published at the name of the host, or at Name below it, e.g. "_sip._udp" for SRV records.
+// Value is the text of TXT, the mail server of MX, the target of SRV and the value of CAA records.
+// Priority is used by MX and SRV, Weight and Port only by SRV, Flag and Tag only by CAA records.
+type Record struct {
+	gorm.Model
+	Host     Host   `validate:"required"`
+	HostID   uint   `gorm:"index"`
+	Type     string `gorm:"size:8;not null" form:"type" validate:"oneof=TXT MX SRV CAA"`
+	Name     string `form:"name" validate:"max=190"`
+	Value    string `gorm:"not null" form:"value" validate:"required,max=2048"`
+	Priority int    `form:"priority" validate:"min=0,max=65535"`
+	Weight   int    `form:"weight" validate:"min=0,max=65535"`
+	Port     int    `form:"port" validate:"min=0,max=65535"`
+	Flag     int    `form:"flag" validate:"oneof=0 128"`
+	Tag      string `form:"tag"`
+	Ttl      int    `form:"ttl" validate:"required,min=20,max=86400"`
+}
+
+// Owner returns the name of the record within the zone of its host.
+func (r *Record) Owner() string {
+	if r.Name == "" {
+		return r.Host.Hostname
+	}
+
+	return r.Name + "." + r.Host.Hostname
+}
+
+// Check validates the fields depending on the record type.
+// Fields which aren't used by the type are reset.
+func (r *Record) Check() error {
+	for _, field := range []string{r.Name, r.Value, r.Tag} {
+		if strings.IndexFunc(field, isControl) >= 0 {
+			return fmt.Errorf("records must not contain control characters")
+		}
+	}
+	if r.Name != "" && (!domainName.MatchString(r.Name) || strings.HasSuffix(r.Name, ".")) {
+		return fmt.Errorf("name %q is not a valid label", r.Name)
+	}
+
+	if r.Type != RecordMX && r.Type != RecordSRV {
+		r.Priority = 0
+	}
+	if r.Type != RecordSRV {
+		r.Weight, r.Port = 0, 0
+	}
+	if r.Type != RecordCAA {
+		r.Flag, r.Tag = 0, ""
+	}
+
+	switch r.Type {
+	case RecordTXT:
+	case RecordMX:
+		if !domainName.MatchString(r.Value) {
+			return fmt.Errorf("mail server %q is not a domain name", r.Value)
+		}
+	case RecordSRV:
+		if !srvName.MatchString(r.Name) {
+			return fmt.Errorf("name of srv records has to be _service._proto, e.g. _sip._udp")
+		}
+		if r.Value == "." {
+			// "." announces that the service isn't available
+			r.Port = 0
+		} else if !domainName.MatchString(r.Value) || r.Port == 0 {
+			return fmt.Errorf("srv records need a target domain name and port, or the target \".\"")
+		}
+	case RecordCAA:
+		switch r.Tag {
+		case "issue", "issuewild":
+			if strings.ContainsAny(r.Value, "\"\\") {
+				return fmt.Errorf("value of caa %s records must not contain quotes", r.Tag)
+			}
+		case "iodef":
+			if !strings.HasPrefix(r.Value, "mailto:") && !strings.HasPrefix(r.Value, "https://") && !strings.HasPrefix(r.Value, "http://") {
+				return fmt.Errorf("value of caa iodef records has to be a mailto: or http(s) url")
+			}
+		default:
+			return fmt.Errorf("tag of caa records has to be issue, issuewild or iodef")
+		}
+	default:
+		return fmt.Errorf("unsupported record type %q", r.Type)
+	}
+
+	return nil
+}
+
+func isControl(c rune) bool {
+	return c < ' ' || c == 0x7f
+}
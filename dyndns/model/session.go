@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is a login session of the admin ui, identified by a cookie.
+// Only the SHA-256 hash of the session cookie is stored.
+type Session struct {
+	gorm.Model
+	Hash      string `gorm:"unique;size:255;not null"`
+	UserName  string
+	Role      string
+	IDToken   string
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// Expired tells if the session can't be used anymore.
+func (s *Session) Expired() bool {
+	return time.Now().After(s.ExpiresAt)
+}
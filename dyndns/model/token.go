@@ -0,0 +1,65 @@
+package model
+
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Scopes an api token can be granted.
+const (
+	ScopeReadOnly    = "read-only"
+	ScopeHostsWrite  = "hosts:write"
+	ScopeCNamesWrite = "cnames:write"
+	ScopeLogsRead    = "logs:read"
+)
+
+// ScopeAdmin is required for routes which are reserved for admin logins,
+// it can not be granted to api tokens.
+const ScopeAdmin = "admin"
+
+// TokenScopes lists all scopes an api token can be granted.
+var TokenScopes = []string{ScopeReadOnly, ScopeHostsWrite, ScopeCNamesWrite, ScopeLogsRead}
+
+// Token is a named api token used by automation instead of the admin login.
+// Only the SHA-256 hash of the token is stored.
+type Token struct {
+	gorm.Model
+	Name     string `gorm:"unique;size:255;not null" validate:"required,max=64"`
+	Hash     string `gorm:"unique;size:255;not null"`
+	Prefix   string
+	Scopes   string
+	LastUsed time.Time
+}
+
+// ScopeList returns the scopes granted to the token.
+func (t *Token) ScopeList() []string {
+	if t.Scopes == "" {
+		return []string{}
+	}
+
+	return strings.Split(t.Scopes, ",")
+}
+
+// HasScope tells if the token has been granted scope.
+func (t *Token) HasScope(scope string) bool {
+	for _, s := range t.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidScope tells if scope can be granted to an api token.
+func ValidScope(scope string) bool {
+	for _, s := range TokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
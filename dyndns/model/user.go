@@ -0,0 +1,104 @@
+package model
+
+import (
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Roles an admin user can have.
+const (
+	RoleOwner    = "owner"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+)
+
+// Roles lists all roles an admin user can have.
+var Roles = []string{RoleOwner, RoleOperator, RoleViewer}
+
+// roleScopes maps each role to the scopes it grants.
+var roleScopes = map[string][]string{
+	RoleOwner:    {ScopeReadOnly, ScopeHostsWrite, ScopeCNamesWrite, ScopeLogsRead, ScopeAdmin},
+	RoleOperator: {ScopeReadOnly, ScopeHostsWrite, ScopeCNamesWrite, ScopeLogsRead},
+	RoleViewer:   {ScopeReadOnly, ScopeLogsRead},
+}
+
+// User is an admin login stored in the database.
+// A tenant only sees and manages the hosts of its domains and the hosts it owns.
+type User struct {
+	gorm.Model
+	UserName string `gorm:"unique;size:255;not null" validate:"required,min=3,max=64"`
+	Password string `validate:"required,min=8"`
+	Role     string `validate:"required,oneof=owner operator viewer"`
+	Tenant   bool
+	// Domains is the comma separated list of domains of a tenant.
+	Domains string
+
+	storedPassword string
+}
+
+// AfterFind remembers the stored password hash, so saving the user doesn't hash it again.
+func (u *User) AfterFind(tx *gorm.DB) error {
+	u.storedPassword = u.Password
+
+	return nil
+}
+
+// BeforeSave hashes the password, if a new one has been set.
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	hash, err := hashNewPassword(u.Password, u.storedPassword)
+	if err != nil {
+		return err
+	}
+	u.Password, u.storedPassword = hash, hash
+
+	return nil
+}
+
+// CheckPassword compares password with the stored password hash in constant time.
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password)) == nil
+}
+
+// DomainList returns the domains of a tenant.
+func (u *User) DomainList() []string {
+	if u.Domains == "" {
+		return []string{}
+	}
+
+	return strings.Split(u.Domains, ",")
+}
+
+// HasDomain tells if domain belongs to the user.
+// Users which are no tenants have access to all domains.
+func (u *User) HasDomain(domain string) bool {
+	if !u.Tenant {
+		return true
+	}
+
+	for _, d := range u.DomainList() {
+		if d == domain {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RoleHasScope tells if role grants scope.
+func RoleHasScope(role string, scope string) bool {
+	for _, s := range roleScopes[role] {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidRole tells if role is a known admin role.
+func ValidRole(role string) bool {
+	_, ok := roleScopes[role]
+	return ok
+}
@@ -0,0 +1,77 @@
+package model
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Events a webhook can be subscribed to.
+const (
+	EventIPChange     = "ip_change"
+	EventUpdateFailed = "update_failed"
+	EventHostCreated  = "host_created"
+	EventHostDeleted  = "host_deleted"
+)
+
+// WebhookEvents lists all events a webhook can be subscribed to.
+var WebhookEvents = []string{EventIPChange, EventUpdateFailed, EventHostCreated, EventHostDeleted}
+
+// Webhook receives signed events of all hosts or, if HostID is set, of a single host.
+// The secret is stored as is, since it is needed to sign the payloads.
+type Webhook struct {
+	gorm.Model
+	URL    string `gorm:"not null" validate:"required,url"`
+	Secret string `gorm:"not null" validate:"required,min=16"`
+	// Events is a comma separated list, an empty list subscribes to all events.
+	Events string
+	HostID uint `gorm:"index"`
+}
+
+// EventList returns the events the webhook is subscribed to.
+func (w *Webhook) EventList() []string {
+	if w.Events == "" {
+		return []string{}
+	}
+
+	return strings.Split(w.Events, ",")
+}
+
+// HasEvent tells if the webhook is subscribed to event.
+func (w *Webhook) HasEvent(event string) bool {
+	if w.Events == "" {
+		return true
+	}
+
+	for _, e := range w.EventList() {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidEvent tells if a webhook can be subscribed to event.
+func ValidEvent(event string) bool {
+	for _, e := range WebhookEvents {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WebhookDelivery logs the delivery of an event to a webhook.
+type WebhookDelivery struct {
+	gorm.Model
+	WebhookID  uint `gorm:"index"`
+	Event      string
+	Host       string
+	Payload    string
+	Attempts   int
+	StatusCode int
+	Error      string
+	Success    bool
+}
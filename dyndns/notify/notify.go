@@ -0,0 +1,254 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Message is a notification about an event of a host.
+type Message struct {
+	Event string `json:"event"`
+	Host  string `json:"host"`
+	Title string `json:"title"`
+	Body  string `json:"message"`
+}
+
+// Notifier sends notifications through a channel.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// Config selects the channels notifications are sent through, channels without url or address are disabled.
+type Config struct {
+	WebhookURL  string
+	SMTPAddr    string
+	SMTPFrom    string
+	SMTPTo      []string
+	NtfyURL     string
+	NtfyToken   string
+	GotifyURL   string
+	GotifyToken string
+}
+
+// New creates a notifier sending to all configured channels.
+func New(config Config) (Multi, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	notifiers := Multi{}
+
+	if config.WebhookURL != "" {
+		notifiers = append(notifiers, &Webhook{URL: config.WebhookURL, Client: client})
+	}
+
+	if config.SMTPAddr != "" {
+		if config.SMTPFrom == "" || len(config.SMTPTo) == 0 {
+			return nil, fmt.Errorf("smtp sender and recipients have to be set")
+		}
+		notifiers = append(notifiers, &SMTP{Addr: config.SMTPAddr, From: config.SMTPFrom, To: config.SMTPTo})
+	}
+
+	if config.NtfyURL != "" {
+		notifiers = append(notifiers, &Ntfy{URL: config.NtfyURL, Token: config.NtfyToken, Client: client})
+	}
+
+	if config.GotifyURL != "" {
+		if config.GotifyToken == "" {
+			return nil, fmt.Errorf("gotify token has to be set")
+		}
+		notifiers = append(notifiers, &Gotify{URL: config.GotifyURL, Token: config.GotifyToken, Client: client})
+	}
+
+	return notifiers, nil
+}
+
+// Multi sends notifications to all of its notifiers.
+type Multi []Notifier
+
+// Notify implements Notifier, the errors of all notifiers are joined.
+func (m Multi) Notify(ctx context.Context, msg Message) error {
+	errs := []error{}
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, msg); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Webhook posts the message as json.
+type Webhook struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify implements Notifier.
+func (w *Webhook) Notify(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	return post(ctx, w.Client, w.URL, "application/json", body, nil)
+}
+
+// smtpTimeout limits the delivery of a mail including the dial.
+const smtpTimeout = 30 * time.Second
+
+// SMTP sends the message as mail through a relay, which doesn't require authentication.
+type SMTP struct {
+	Addr string
+	From string
+	To   []string
+}
+
+// Notify implements Notifier.
+// The delivery is aborted, if ctx is done or the relay doesn't finish within smtpTimeout.
+func (s *SMTP) Notify(ctx context.Context, msg Message) error {
+	mail := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		s.From, strings.Join(s.To, ", "), msg.Title, msg.Body)
+
+	ctx, cancel := context.WithTimeout(ctx, smtpTimeout)
+	defer cancel()
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	deadline, _ := ctx.Deadline()
+	if err = conn.SetDeadline(deadline); err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	host, _, err := net.SplitHostPort(s.Addr)
+	if err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(s.From); err != nil {
+		return err
+	}
+	for _, to := range s.To {
+		if err = client.Rcpt(to); err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write([]byte(mail)); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// Ntfy publishes the message to a ntfy topic url.
+type Ntfy struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+// Notify implements Notifier.
+func (n *Ntfy) Notify(ctx context.Context, msg Message) error {
+	header := http.Header{}
+	header.Set("Title", msg.Title)
+	header.Set("Tags", msg.Event)
+	if n.Token != "" {
+		header.Set("Authorization", "Bearer "+n.Token)
+	}
+
+	return post(ctx, n.Client, n.URL, "text/plain", []byte(msg.Body), header)
+}
+
+// Gotify sends the message to a gotify server with an application token.
+type Gotify struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+// Notify implements Notifier.
+func (g *Gotify) Notify(ctx context.Context, msg Message) error {
+	body, err := json.Marshal(map[string]interface{}{"title": msg.Title, "message": msg.Body, "priority": 5})
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("X-Gotify-Key", g.Token)
+
+	return post(ctx, g.Client, strings.TrimSuffix(g.URL, "/")+"/message", "application/json", body, header)
+}
+
+// post sends body to target and fails on non 2xx responses.
+func post(ctx context.Context, client *http.Client, target string, contentType string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	for key := range header {
+		req.Header.Set(key, header.Get(key))
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = redact(urlErr.URL)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("notification to %s failed: %s", redact(target), resp.Status)
+	}
+
+	return nil
+}
+
+// redact removes the query and credentials of target, so tokens don't end up in logs.
+func redact(target string) string {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "invalid url"
+	}
+	u.User = nil
+	u.RawQuery = ""
+
+	return u.String()
+}
@@ -0,0 +1,117 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testMessage = Message{Event: "stale", Host: "blog.dyndns.example.com", Title: "blog.dyndns.example.com is stale", Body: "No update"}
+
+func TestNotifyToSendToHTTPChannels(t *testing.T) {
+	requests := map[string]*http.Request{}
+	bodies := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests[r.URL.Path] = r
+		bodies[r.URL.Path] = string(body)
+	}))
+	defer server.Close()
+
+	notifier, err := New(Config{
+		WebhookURL:  server.URL + "/webhook",
+		NtfyURL:     server.URL + "/ddns",
+		NtfyToken:   "ntfytoken",
+		GotifyURL:   server.URL + "/",
+		GotifyToken: "gotifytoken",
+	})
+	if err != nil || len(notifier) != 3 {
+		t.Fatalf("Expected three notifiers but got %v (%v)", notifier, err)
+	}
+
+	if err = notifier.Notify(context.Background(), testMessage); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	webhook := Message{}
+	if err = json.Unmarshal([]byte(bodies["/webhook"]), &webhook); err != nil || webhook != testMessage {
+		t.Fatalf("Expected webhook message %+v but got %s", testMessage, bodies["/webhook"])
+	}
+
+	if r := requests["/ddns"]; bodies["/ddns"] != "No update" || r.Header.Get("Title") != testMessage.Title || r.Header.Get("Authorization") != "Bearer ntfytoken" {
+		t.Fatalf("Expected ntfy message with title and token but got %s %v", bodies["/ddns"], r.Header)
+	}
+
+	if r := requests["/message"]; !strings.Contains(bodies["/message"], `"title":"blog.dyndns.example.com is stale"`) || r.Header.Get("X-Gotify-Key") != "gotifytoken" {
+		t.Fatalf("Expected gotify message with token but got %s %v", bodies["/message"], r.Header)
+	}
+}
+
+func TestNotifyToReturnErrorsOfAllChannels(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	notifier, _ := New(Config{WebhookURL: server.URL + "/webhook?token=secret", NtfyURL: server.URL + "/ddns"})
+	err := notifier.Notify(context.Background(), testMessage)
+	if err == nil || !strings.Contains(err.Error(), "/webhook") || !strings.Contains(err.Error(), "/ddns") {
+		t.Fatalf("Expected errors of both channels but got %v", err)
+	}
+
+	if strings.Contains(err.Error(), "secret") {
+		t.Fatalf("Expected the token to be redacted but got %v", err)
+	}
+}
+
+func TestSMTPNotifyToAbortHungRelay(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+	defer listener.Close()
+
+	// the relay accepts connections but never greets
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- (&SMTP{Addr: listener.Addr().String(), From: "ddns@example.com", To: []string{"admin@example.com"}}).Notify(ctx, testMessage)
+	}()
+
+	select {
+	case err = <-done:
+		if err == nil {
+			t.Fatal("Expected hung relay to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected delivery to be aborted with the context")
+	}
+}
+
+func TestNewToRejectIncompleteChannels(t *testing.T) {
+	if _, err := New(Config{SMTPAddr: "localhost:25"}); err == nil {
+		t.Fatalf("Expected smtp without recipients to be rejected")
+	}
+
+	if _, err := New(Config{GotifyURL: "http://localhost"}); err == nil {
+		t.Fatalf("Expected gotify without token to be rejected")
+	}
+}
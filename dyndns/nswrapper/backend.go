@@ -0,0 +1,69 @@
+package nswrapper
+
+import (
+	"fmt"
+	"time"
+)
+
+// DNSBackend is implemented by every name server the dyndns server is able to drive.
+type DNSBackend interface {
+	// UpdateRecord replaces all records of type addrType of hostname.zone with target.
+	UpdateRecord(hostname string, target string, addrType string, zone string, ttl int, enableWildcard bool) error
+	// DeleteRecord removes all records of hostname.zone.
+	DeleteRecord(hostname string, zone string, enableWildcard bool) error
+	// DeleteRecordType removes all records of type addrType of hostname.zone.
+	DeleteRecordType(hostname string, addrType string, zone string, enableWildcard bool) error
+	// UpdateRecordSet replaces all records of type addrType of hostname.zone with one record per target.
+	// An empty list of targets removes the records.
+	UpdateRecordSet(hostname string, targets []string, addrType string, zone string, ttl int) error
+	// AddRecord adds a record of type addrType with target to hostname.zone and keeps all other records.
+	AddRecord(hostname string, target string, addrType string, zone string, ttl int) error
+	// RemoveRecord removes the record of type addrType with target from hostname.zone.
+	RemoveRecord(hostname string, target string, addrType string, zone string) error
+	// ListRecords returns all records the name server holds for zone.
+	ListRecords(zone string) ([]Record, error)
+}
+
+// Record is a single resource record as reported by a DNSBackend.
+type Record struct {
+	Name   string `json:"name"`
+	Ttl    int    `json:"ttl"`
+	Type   string `json:"type"`
+	Target string `json:"target"`
+}
+
+// Config selects and configures the DNS backend.
+type Config struct {
+	Backend     string
+	Server      string
+	Port        string
+	TsigKeyName string
+	TsigSecret  string
+}
+
+// NewBackend creates the DNS backend selected by config.
+func NewBackend(config Config) (DNSBackend, error) {
+	server := config.Server
+	if server == "" {
+		server = "localhost"
+	}
+
+	switch config.Backend {
+	case "", "nsupdate":
+		// nsupdate stays the default, deployments from before the other backends rely on it
+		return &NSUpdate{Server: server}, nil
+	case "rfc2136":
+		if (config.TsigKeyName == "") != (config.TsigSecret == "") {
+			return nil, fmt.Errorf("tsig key name and secret have to be set together")
+		}
+
+		return &RFC2136{
+			Server:      joinHostPort(server, config.Port),
+			TsigKeyName: config.TsigKeyName,
+			TsigSecret:  config.TsigSecret,
+			Timeout:     10 * time.Second,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown dns backend: %s", config.Backend)
+	}
+}
@@ -1,9 +1,7 @@
 package nswrapper
 
 import (
-	"bytes"
-	"errors"
-	"github.com/labstack/gommon/log"
+	"fmt"
 	"net"
 	"net/http"
 	"strings"
@@ -22,88 +20,208 @@ func GetIPType(ipAddr string) string {
 	}
 }
 
-// GetCallerIP searches for the "real" IP senders has actually.
-// If its a private address we won't use it.
-func GetCallerIP(r *http.Request) (string, error) {
-	log.Info("request", r.Header)
-	for _, h := range []string{"X-Real-Ip", "X-Forwarded-For"} {
-		addresses := strings.Split(r.Header.Get(h), ",")
-		// march from right to left until we get a public address
-		// that will be the address right before our proxy.
-		for i := len(addresses) - 1; i >= 0; i-- {
-			ip := strings.TrimSpace(addresses[i])
-			// header can contain spaces too, strip those out.
-			realIP := net.ParseIP(ip)
-			if !realIP.IsGlobalUnicast() || isPrivateSubnet(realIP) {
-				// bad address, go to next
-				continue
-			}
-			return ip, nil
+// TrustedProxies are the networks of the proxies, whose forwarded headers are honored.
+type TrustedProxies []*net.IPNet
+
+// DefaultForwardedHeader is the header honored by default to find the caller IP behind trusted proxies.
+const DefaultForwardedHeader = "X-Forwarded-For"
+
+// ParseForwardedHeader returns the canonical name of a supported forwarded header.
+func ParseForwardedHeader(name string) (string, error) {
+	name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+	switch name {
+	case "Forwarded", "X-Forwarded-For", "X-Real-Ip":
+		return name, nil
+	default:
+		return "", fmt.Errorf("unsupported forwarded header %q, use Forwarded, X-Forwarded-For or X-Real-Ip", name)
+	}
+}
+
+// privateNetworks are the private, shared, loopback and link-local networks of IPv4 and IPv6.
+var privateNetworks = mustParseNetworks([]string{
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+})
+
+// IsPrivate reports whether ip is a private, shared, loopback or link-local address.
+// IPv4-mapped IPv6 addresses are classified by their IPv4 address.
+func IsPrivate(ip net.IP) bool {
+	return privateNetworks.Contains(ip)
+}
+
+// ParseTrustedProxies parses a list of networks in CIDR notation or single IP addresses.
+// The item "private" adds all private, shared, loopback and link-local networks.
+// IPv4-mapped IPv6 addresses and networks are taken as IPv4.
+func ParseTrustedProxies(list []string) (TrustedProxies, error) {
+	proxies := TrustedProxies{}
+	for _, item := range list {
+		if item == "private" {
+			proxies = append(proxies, privateNetworks...)
+			continue
+		}
+
+		network, err := parseNetwork(item)
+		if err != nil {
+			return nil, err
 		}
+		proxies = append(proxies, network)
 	}
-	return "", errors.New("no match")
+
+	return proxies, nil
 }
 
-// ShrinkUserAgent simply cuts the user agent information if its too long to display.
-func ShrinkUserAgent(agent string) string {
-	agentParts := strings.Split(agent, " ")
+// parseNetwork parses a network in CIDR notation or a single IP address.
+func parseNetwork(item string) (*net.IPNet, error) {
+	if !strings.Contains(item, "/") {
+		ip := net.ParseIP(item)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q", item)
+		}
 
-	return agentParts[0]
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	_, network, err := net.ParseCIDR(item)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxy %q: %w", item, err)
+	}
+	if ones, bits := network.Mask.Size(); bits == 8*net.IPv6len && ones >= 96 && network.IP.To4() != nil {
+		network = &net.IPNet{IP: network.IP.To4(), Mask: net.CIDRMask(ones-96, 8*net.IPv4len)}
+	}
+
+	return network, nil
 }
 
-// ipRange - a structure that holds the start and end of a range of ip addresses
-type ipRange struct {
-	start net.IP
-	end   net.IP
+func mustParseNetworks(list []string) TrustedProxies {
+	networks := TrustedProxies{}
+	for _, item := range list {
+		network, err := parseNetwork(item)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
 }
 
-// inRange - check to see if a given ip address is within a range given
-func inRange(r ipRange, ipAddress net.IP) bool {
-	// strcmp type byte comparison
-	if bytes.Compare(ipAddress, r.start) >= 0 && bytes.Compare(ipAddress, r.end) < 0 {
-		return true
+// Contains reports whether ip is part of one of the trusted networks.
+func (t TrustedProxies) Contains(ip net.IP) bool {
+	for _, network := range t {
+		if network.Contains(ip) {
+			return true
+		}
 	}
+
 	return false
 }
 
-var privateRanges = []ipRange{
-	ipRange{
-		start: net.ParseIP("10.0.0.0"),
-		end:   net.ParseIP("10.255.255.255"),
-	},
-	ipRange{
-		start: net.ParseIP("100.64.0.0"),
-		end:   net.ParseIP("100.127.255.255"),
-	},
-	ipRange{
-		start: net.ParseIP("172.16.0.0"),
-		end:   net.ParseIP("172.31.255.255"),
-	},
-	ipRange{
-		start: net.ParseIP("192.0.0.0"),
-		end:   net.ParseIP("192.0.0.255"),
-	},
-	ipRange{
-		start: net.ParseIP("192.168.0.0"),
-		end:   net.ParseIP("192.168.255.255"),
-	},
-	ipRange{
-		start: net.ParseIP("198.18.0.0"),
-		end:   net.ParseIP("198.19.255.255"),
-	},
+// GetCallerIP searches for the "real" IP senders has actually.
+// The forwarded header is only honored, if the request has been received from a trusted proxy.
+// It is one of Forwarded (RFC 7239), X-Forwarded-For or X-Real-Ip and walked from right to left
+// until an address, which isn't a trusted proxy, is found. The other headers are ignored,
+// as a proxy passes them through from the client unchanged.
+func GetCallerIP(r *http.Request, trusted TrustedProxies, header string) (string, error) {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "", err
+	}
+
+	peerIP := net.ParseIP(peer)
+	if peerIP == nil {
+		return "", fmt.Errorf("invalid remote address %q", r.RemoteAddr)
+	}
+
+	if !trusted.Contains(peerIP) {
+		return peerIP.String(), nil
+	}
+
+	chain := splitHeader(r.Header.Values(header))
+	if http.CanonicalHeaderKey(header) == "Forwarded" {
+		chain = forwardedFor(r.Header.Values(header))
+	}
+	if ip := walkChain(chain, trusted); ip != nil {
+		return ip.String(), nil
+	}
+
+	return peerIP.String(), nil
+}
+
+// walkChain returns the rightmost address of chain, which isn't a trusted proxy.
+// If all addresses are trusted, the leftmost one is returned.
+// Walking stops at invalid and obfuscated addresses.
+func walkChain(chain []string, trusted TrustedProxies) net.IP {
+	var ip net.IP
+	for i := len(chain) - 1; i >= 0; i-- {
+		hop := net.ParseIP(chain[i])
+		if hop == nil {
+			return ip
+		}
+
+		ip = hop
+		if !trusted.Contains(hop) {
+			return ip
+		}
+	}
+
+	return ip
 }
 
-// isPrivateSubnet - check to see if this ip is in a private subnet
-func isPrivateSubnet(ipAddress net.IP) bool {
-	// my use case is only concerned with ipv4 atm
-	if ipCheck := ipAddress.To4(); ipCheck != nil {
-		// iterate over all our ranges
-		for _, r := range privateRanges {
-			// check if this ip is in a private range
-			if inRange(r, ipAddress) {
-				return true
+// splitHeader splits the comma separated values of a header.
+func splitHeader(values []string) []string {
+	chain := []string{}
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				chain = append(chain, item)
 			}
 		}
 	}
-	return false
+
+	return chain
+}
+
+// forwardedFor returns the addresses of the "for" parameters of Forwarded headers (RFC 7239).
+// Ports and the brackets of IPv6 addresses are removed.
+func forwardedFor(values []string) []string {
+	chain := []string{}
+	for _, element := range splitHeader(values) {
+		node := ""
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				node = strings.Trim(value, `"`)
+			}
+		}
+
+		if strings.HasPrefix(node, "[") {
+			if end := strings.Index(node, "]"); end > 0 {
+				node = node[1:end]
+			}
+		} else if host, _, err := net.SplitHostPort(node); err == nil {
+			node = host
+		}
+		chain = append(chain, node)
+	}
+
+	return chain
+}
+
+// ShrinkUserAgent simply cuts the user agent information if its too long to display.
+func ShrinkUserAgent(agent string) string {
+	agentParts := strings.Split(agent, " ")
+
+	return agentParts[0]
 }
@@ -0,0 +1,122 @@
+package nswrapper
+
+import (
+	"net"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetCallerIPToIgnoreHeadersOfUntrustedPeers(t *testing.T) {
+	r := httptest.NewRequest("GET", "/update", nil)
+	r.RemoteAddr = "203.0.113.7:4711"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	r.Header.Set("X-Real-Ip", "198.51.100.1")
+
+	ip, err := GetCallerIP(r, nil, DefaultForwardedHeader)
+	if err != nil || ip != "203.0.113.7" {
+		t.Fatalf("Expected peer address 203.0.113.7 but got %s (%v)", ip, err)
+	}
+}
+
+func TestGetCallerIPToWalkForwardedChainOfTrustedPeers(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "2001:db8:cafe::1"})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	for _, test := range []struct {
+		remoteAddr string
+		header     string
+		value      string
+		expected   string
+	}{
+		{"10.0.0.2:80", "X-Forwarded-For", "198.51.100.9, 198.51.100.1, 10.0.0.3", "198.51.100.1"},
+		{"10.0.0.2:80", "X-Forwarded-For", "198.51.100.1", "198.51.100.1"},
+		{"10.0.0.2:80", "X-Forwarded-For", "198.51.100.1, ::ffff:10.0.0.3", "198.51.100.1"},
+		{"10.0.0.2:80", "X-Real-Ip", "198.51.100.1", "198.51.100.1"},
+		{"10.0.0.2:80", "Forwarded", `for=198.51.100.1:4711;proto=https, for="[2001:db8:cafe::1]:80"`, "198.51.100.1"},
+		{"[2001:db8:cafe::1]:80", "Forwarded", `For="[2001:db8::17]:4711"`, "2001:db8::17"},
+		{"10.0.0.2:80", "Forwarded", "for=_hidden, for=10.0.0.3", "10.0.0.3"},
+		{"10.0.0.2:80", "X-Forwarded-For", "unknown", "10.0.0.2"},
+		{"10.0.0.2:80", "", "", "10.0.0.2"},
+	} {
+		r := httptest.NewRequest("GET", "/update", nil)
+		r.RemoteAddr = test.remoteAddr
+		header := DefaultForwardedHeader
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+			header = test.header
+		}
+
+		ip, err := GetCallerIP(r, trusted, header)
+		if err != nil || ip != test.expected {
+			t.Fatalf("Expected %s for %s %q but got %s (%v)", test.expected, test.header, test.value, ip, err)
+		}
+	}
+}
+
+func TestGetCallerIPToIgnoreOtherHeaders(t *testing.T) {
+	trusted, _ := ParseTrustedProxies([]string{"10.0.0.2"})
+
+	r := httptest.NewRequest("GET", "/update", nil)
+	r.RemoteAddr = "10.0.0.2:80"
+	r.Header.Set("Forwarded", "for=198.51.100.66")
+	r.Header.Set("X-Real-Ip", "198.51.100.66")
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+
+	ip, err := GetCallerIP(r, trusted, "X-Forwarded-For")
+	if err != nil || ip != "198.51.100.1" {
+		t.Fatalf("Expected address of the configured header 198.51.100.1 but got %s (%v)", ip, err)
+	}
+}
+
+func TestParseForwardedHeaderToCanonicalizeNames(t *testing.T) {
+	if header, err := ParseForwardedHeader("x-real-ip"); err != nil || header != "X-Real-Ip" {
+		t.Fatalf("Expected X-Real-Ip but got %s (%v)", header, err)
+	}
+
+	if _, err := ParseForwardedHeader("X-Client-Ip"); err == nil {
+		t.Fatal("Expected unsupported header to be rejected")
+	}
+}
+
+func TestIsPrivateToClassifyAddresses(t *testing.T) {
+	for _, ip := range []string{"10.1.2.3", "172.31.255.255", "192.168.0.1", "100.64.0.1", "127.0.0.1", "169.254.1.1", "::ffff:10.0.0.1", "::ffff:192.168.1.1", "::1", "fc00::1", "fd12:3456::1", "fe80::1", "febf::1"} {
+		if !IsPrivate(net.ParseIP(ip)) {
+			t.Fatalf("Expected %s to be private", ip)
+		}
+	}
+
+	for _, ip := range []string{"172.32.0.1", "192.169.0.1", "8.8.8.8", "::ffff:8.8.8.8", "2001:db8::1", "fec0::1", "fbff::1", "::"} {
+		if IsPrivate(net.ParseIP(ip)) {
+			t.Fatalf("Expected %s not to be private", ip)
+		}
+	}
+}
+
+func TestParseTrustedProxiesToTakeMappedAddressesAsIPv4(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"::ffff:10.0.0.0/104", "::ffff:192.0.2.1", "private"})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	for _, ip := range []string{"10.0.0.1", "::ffff:10.0.0.1", "192.0.2.1", "::ffff:192.0.2.1", "fd00::1"} {
+		if !trusted.Contains(net.ParseIP(ip)) {
+			t.Fatalf("Expected %s to be trusted", ip)
+		}
+	}
+
+	if trusted.Contains(net.ParseIP("192.0.2.2")) {
+		t.Fatal("Expected 192.0.2.2 not to be trusted")
+	}
+}
+
+func TestParseTrustedProxiesToRejectInvalidEntries(t *testing.T) {
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Fatalf("Expected invalid cidr to be rejected")
+	}
+
+	if _, err := ParseTrustedProxies([]string{"proxy.example.com"}); err == nil {
+		t.Fatalf("Expected hostname to be rejected")
+	}
+}
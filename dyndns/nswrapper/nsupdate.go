@@ -0,0 +1,198 @@
+package nswrapper
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/gommon/log"
+)
+
+const (
+	nsupdateBinary = "/usr/bin/nsupdate"
+	digBinary      = "/usr/bin/dig"
+)
+
+// NSUpdate drives a BIND name server by executing the nsupdate binary.
+type NSUpdate struct {
+	Server string
+}
+
+// UpdateRecord builds a nsupdate file and updates a record by executing it with nsupdate.
+func (n *NSUpdate) UpdateRecord(hostname string, target string, addrType string, zone string, ttl int, enableWildcard bool) error {
+	log.Info(fmt.Sprintf("%s record update request: %s -> %s", addrType, hostname, target))
+
+	lines := []string{fmt.Sprintf("update delete %s.%s %s", hostname, zone, addrType)}
+	if enableWildcard {
+		lines = append(lines, fmt.Sprintf("update delete %s.%s %s", "*."+hostname, zone, addrType))
+	}
+	lines = append(lines, fmt.Sprintf("update add %s.%s %v %s %s", hostname, zone, ttl, addrType, target))
+	if enableWildcard {
+		lines = append(lines, fmt.Sprintf("update add %s.%s %v %s %s", "*."+hostname, zone, ttl, addrType, target))
+	}
+
+	return n.update(zone, lines...)
+}
+
+// DeleteRecordType builds a nsupdate file and deletes all records of type addrType by executing it with nsupdate.
+func (n *NSUpdate) DeleteRecordType(hostname string, addrType string, zone string, enableWildcard bool) error {
+	log.Info(fmt.Sprintf("%s record delete request: %s", addrType, hostname))
+
+	lines := []string{fmt.Sprintf("update delete %s.%s %s", hostname, zone, addrType)}
+	if enableWildcard {
+		lines = append(lines, fmt.Sprintf("update delete %s.%s %s", "*."+hostname, zone, addrType))
+	}
+
+	return n.update(zone, lines...)
+}
+
+// DeleteRecord builds a nsupdate file and deletes a record by executing it with nsupdate.
+func (n *NSUpdate) DeleteRecord(hostname string, zone string, enableWildcard bool) error {
+	log.Info(fmt.Sprintf("record delete request: %s", hostname))
+
+	lines := []string{fmt.Sprintf("update delete %s.%s", hostname, zone)}
+	if enableWildcard {
+		lines = append(lines, fmt.Sprintf("update delete %s.%s", "*."+hostname, zone))
+	}
+
+	return n.update(zone, lines...)
+}
+
+// UpdateRecordSet builds a nsupdate file and replaces all records of type addrType by executing it with nsupdate.
+func (n *NSUpdate) UpdateRecordSet(hostname string, targets []string, addrType string, zone string, ttl int) error {
+	log.Info(fmt.Sprintf("%s record set update request: %s -> %s", addrType, hostname, strings.Join(targets, ", ")))
+
+	return n.update(zone, recordSetLines(hostname, targets, addrType, zone, ttl)...)
+}
+
+// recordSetLines returns the nsupdate lines replacing the records of type addrType of hostname.zone.
+func recordSetLines(hostname string, targets []string, addrType string, zone string, ttl int) []string {
+	lines := []string{fmt.Sprintf("update delete %s.%s %s", hostname, zone, addrType)}
+	for _, target := range targets {
+		lines = append(lines, fmt.Sprintf("update add %s.%s %v %s %s", hostname, zone, ttl, addrType, target))
+	}
+
+	return lines
+}
+
+// AddRecord builds a nsupdate file and adds a single record by executing it with nsupdate.
+func (n *NSUpdate) AddRecord(hostname string, target string, addrType string, zone string, ttl int) error {
+	log.Info(fmt.Sprintf("%s record add request: %s -> %s", addrType, hostname, target))
+
+	return n.update(zone, fmt.Sprintf("update add %s.%s %v %s %s", hostname, zone, ttl, addrType, target))
+}
+
+// RemoveRecord builds a nsupdate file and removes a single record by executing it with nsupdate.
+func (n *NSUpdate) RemoveRecord(hostname string, target string, addrType string, zone string) error {
+	log.Info(fmt.Sprintf("%s record remove request: %s -> %s", addrType, hostname, target))
+
+	return n.update(zone, fmt.Sprintf("update delete %s.%s %s %s", hostname, zone, addrType, target))
+}
+
+// update executes a nsupdate file with the given update commands.
+// Commands containing line breaks are refused, they would inject further commands into the file.
+func (n *NSUpdate) update(zone string, lines ...string) error {
+	script, err := updateScript(n.Server, zone, lines)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(os.TempDir(), "dyndns")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(f.Name())
+	if _, err = f.WriteString(script); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return execute(nsupdateBinary, f.Name())
+}
+
+// updateScript returns the nsupdate file sending lines to server.
+func updateScript(server string, zone string, lines []string) (string, error) {
+	script := strings.Builder{}
+	for _, line := range append([]string{"server " + server, "zone " + zone}, lines...) {
+		if strings.ContainsAny(line, "\r\n") {
+			return "", fmt.Errorf("nsupdate command must not contain line breaks: %q", line)
+		}
+		script.WriteString(line + "\n")
+	}
+	script.WriteString("send\n")
+
+	return script.String(), nil
+}
+
+// ListRecords requests a zone transfer with dig and returns all records of the zone.
+// The name server has to allow zone transfers to the dyndns server.
+func (n *NSUpdate) ListRecords(zone string) ([]Record, error) {
+	cmd := exec.Command(digBinary, "@"+n.Server, zone, "AXFR", "+noall", "+answer")
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%v: %v", err, stderr.String())
+	}
+
+	return parseRecords(out.String())
+}
+
+// execute runs a name server tool and treats any output as error.
+func execute(name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("%v: %v", err, stderr.String())
+	}
+
+	if out.String() != "" {
+		return fmt.Errorf("%s", out.String())
+	}
+
+	return nil
+}
+
+// parseRecords parses records in zone file presentation format as printed by dig.
+func parseRecords(output string) ([]Record, error) {
+	records := []Record{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		// <name> <ttl> <class> <type> <rdata...>
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			return nil, fmt.Errorf("unable to parse record: %s", line)
+		}
+
+		ttl, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse ttl of record: %s", line)
+		}
+
+		records = append(records, Record{
+			Name:   fields[0],
+			Ttl:    ttl,
+			Type:   fields[3],
+			Target: strings.Join(fields[4:], " "),
+		})
+	}
+
+	return records, nil
+}
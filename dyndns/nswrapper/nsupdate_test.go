@@ -0,0 +1,61 @@
+package nswrapper
+
+import (
+	"testing"
+)
+
+func TestParseRecordsToReturnAllAnswerRecords(t *testing.T) {
+	output := `; <<>> DiG 9.18.24 <<>> @localhost dyndns.example.com AXFR +noall +answer
+dyndns.example.com.	86400	IN	SOA	ns.example.com. root.dyndns.example.com. 75 3600 900 604800 86400
+blog.dyndns.example.com. 60	IN	A	1.2.3.4
+`
+	records, err := parseRecords(output)
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records but got %d", len(records))
+	}
+
+	expected := Record{Name: "blog.dyndns.example.com.", Ttl: 60, Type: "A", Target: "1.2.3.4"}
+	if records[1] != expected {
+		t.Fatalf("Expected %v but got %v", expected, records[1])
+	}
+
+	if records[0].Target != "ns.example.com. root.dyndns.example.com. 75 3600 900 604800 86400" {
+		t.Fatalf("Expected full SOA rdata but got %s", records[0].Target)
+	}
+}
+
+func TestParseRecordsToReturnErrorOnInvalidTtl(t *testing.T) {
+	if _, err := parseRecords("blog.dyndns.example.com. abc IN A 1.2.3.4"); err == nil {
+		t.Fatalf("Expected an error but got nil")
+	}
+}
+
+func TestRecordSetLinesToReplaceAllRecords(t *testing.T) {
+	lines := recordSetLines("blog", []string{`"one"`, `"two"`}, "TXT", "dyndns.example.com", 300)
+
+	expected := "update delete blog.dyndns.example.com TXT\n" +
+		"update add blog.dyndns.example.com 300 TXT \"one\"\n" +
+		"update add blog.dyndns.example.com 300 TXT \"two\"\n"
+	if script, _ := updateScript("ns", "dyndns.example.com", lines); script != "server ns\nzone dyndns.example.com\n"+expected+"send\n" {
+		t.Fatalf("Expected %q but got %q", expected, script)
+	}
+}
+
+func TestUpdateScriptToRefuseLineBreaks(t *testing.T) {
+	lines := recordSetLines("blog", []string{"1.2.3.4\nupdate delete dyndns.example.com. A"}, "A", "dyndns.example.com", 300)
+
+	if _, err := updateScript("ns", "dyndns.example.com", lines); err == nil {
+		t.Fatal("Expected line break to be refused")
+	}
+}
+
+func TestNewBackendToDefaultToNSUpdate(t *testing.T) {
+	backend, err := NewBackend(Config{})
+	if _, ok := backend.(*NSUpdate); err != nil || !ok {
+		t.Fatalf("Expected nsupdate backend but got %T (%v)", backend, err)
+	}
+}
@@ -0,0 +1,75 @@
+package nswrapper
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxStringLength is the maximum length of a single character string in TXT records.
+const maxStringLength = 255
+
+// RecordData is the data of a TXT, MX, SRV or CAA record.
+type RecordData struct {
+	Type     string
+	Value    string
+	Priority int
+	Weight   int
+	Port     int
+	Flag     int
+	Tag      string
+}
+
+// String returns the data in zone file presentation format, as nsupdate and dns.NewRR expect it.
+// Domain names are taken as absolute.
+func (d RecordData) String() string {
+	switch d.Type {
+	case "TXT":
+		return quoteText(d.Value)
+	case "MX":
+		return fmt.Sprintf("%d %s", d.Priority, dns.Fqdn(d.Value))
+	case "SRV":
+		return fmt.Sprintf("%d %d %d %s", d.Priority, d.Weight, d.Port, dns.Fqdn(d.Value))
+	case "CAA":
+		return fmt.Sprintf("%d %s %s", d.Flag, d.Tag, quote(d.Value))
+	default:
+		return d.Value
+	}
+}
+
+// quoteText splits text into quoted character strings of at most 255 bytes.
+func quoteText(text string) string {
+	if text == "" {
+		return `""`
+	}
+
+	parts := []string{}
+	for len(text) > maxStringLength {
+		parts = append(parts, quote(text[:maxStringLength]))
+		text = text[maxStringLength:]
+	}
+
+	return strings.Join(append(parts, quote(text)), " ")
+}
+
+// quote returns s as quoted character string.
+// Control characters are escaped as \DDD, so s always stays on a single line.
+func quote(s string) string {
+	b := strings.Builder{}
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' || c == '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c == 0x7f:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
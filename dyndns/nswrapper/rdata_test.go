@@ -0,0 +1,31 @@
+package nswrapper
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecordDataToFormatEachType(t *testing.T) {
+	for expected, data := range map[string]RecordData{
+		`"v=spf1 \"mx\" -all"`:               {Type: "TXT", Value: `v=spf1 "mx" -all`},
+		"10 mail.example.com.":               {Type: "MX", Value: "mail.example.com", Priority: 10},
+		"10 5 5060 sip.example.com.":         {Type: "SRV", Value: "sip.example.com.", Priority: 10, Weight: 5, Port: 5060},
+		"0 0 0 .":                            {Type: "SRV", Value: "."},
+		`128 issue "letsencrypt.org"`:        {Type: "CAA", Value: "letsencrypt.org", Flag: 128, Tag: "issue"},
+		`0 iodef "mailto:admin@example.com"`: {Type: "CAA", Value: "mailto:admin@example.com", Tag: "iodef"},
+		`0 issue "ca.org\010send"`:           {Type: "CAA", Value: "ca.org\nsend", Tag: "issue"},
+	} {
+		if data.String() != expected {
+			t.Fatalf("Expected %s but got %s", expected, data.String())
+		}
+	}
+}
+
+func TestRecordDataToSplitLongText(t *testing.T) {
+	text := strings.Repeat("a", 300)
+
+	expected := `"` + strings.Repeat("a", 255) + `" "` + strings.Repeat("a", 45) + `"`
+	if data := (RecordData{Type: "TXT", Value: text}).String(); data != expected {
+		t.Fatalf("Expected text split after 255 characters but got %s", data)
+	}
+}
@@ -0,0 +1,211 @@
+package nswrapper
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/labstack/gommon/log"
+	"github.com/miekg/dns"
+)
+
+// RFC2136 sends RFC 2136 dynamic updates directly to a name server,
+// optionally signed with a HMAC-SHA256 TSIG key.
+type RFC2136 struct {
+	Server      string
+	TsigKeyName string
+	TsigSecret  string
+	Timeout     time.Duration
+}
+
+// UpdateRecord sends the same delete and add sequence as the nsupdate backend in a single update message.
+func (r *RFC2136) UpdateRecord(hostname string, target string, addrType string, zone string, ttl int, enableWildcard bool) error {
+	log.Info(fmt.Sprintf("%s record update request: %s -> %s", addrType, hostname, target))
+
+	rrType, ok := dns.StringToType[addrType]
+	if !ok {
+		return fmt.Errorf("unknown record type: %s", addrType)
+	}
+
+	names := []string{dns.Fqdn(hostname + "." + zone)}
+	if enableWildcard {
+		names = append(names, dns.Fqdn("*."+hostname+"."+zone))
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone))
+	for _, name := range names {
+		m.RemoveRRset([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: name, Rrtype: rrType, Class: dns.ClassINET}}})
+	}
+
+	for _, name := range names {
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", name, ttl, addrType, target))
+		if err != nil {
+			return err
+		}
+		m.Insert([]dns.RR{rr})
+	}
+
+	return r.send(m)
+}
+
+// DeleteRecordType removes all records of type addrType of hostname.zone in a single update message.
+func (r *RFC2136) DeleteRecordType(hostname string, addrType string, zone string, enableWildcard bool) error {
+	log.Info(fmt.Sprintf("%s record delete request: %s", addrType, hostname))
+
+	rrType, ok := dns.StringToType[addrType]
+	if !ok {
+		return fmt.Errorf("unknown record type: %s", addrType)
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone))
+	m.RemoveRRset([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: dns.Fqdn(hostname + "." + zone), Rrtype: rrType, Class: dns.ClassINET}}})
+	if enableWildcard {
+		m.RemoveRRset([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: dns.Fqdn("*." + hostname + "." + zone), Rrtype: rrType, Class: dns.ClassINET}}})
+	}
+
+	return r.send(m)
+}
+
+// DeleteRecord removes all records of hostname.zone in a single update message.
+func (r *RFC2136) DeleteRecord(hostname string, zone string, enableWildcard bool) error {
+	log.Info(fmt.Sprintf("record delete request: %s", hostname))
+
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone))
+	m.RemoveName([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: dns.Fqdn(hostname + "." + zone)}}})
+	if enableWildcard {
+		m.RemoveName([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: dns.Fqdn("*." + hostname + "." + zone)}}})
+	}
+
+	return r.send(m)
+}
+
+// UpdateRecordSet replaces the rrset of type addrType of hostname.zone in a single update message.
+func (r *RFC2136) UpdateRecordSet(hostname string, targets []string, addrType string, zone string, ttl int) error {
+	log.Info(fmt.Sprintf("%s record set update request: %s -> %s", addrType, hostname, strings.Join(targets, ", ")))
+
+	rrType, ok := dns.StringToType[addrType]
+	if !ok {
+		return fmt.Errorf("unknown record type: %s", addrType)
+	}
+
+	name := dns.Fqdn(hostname + "." + zone)
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone))
+	m.RemoveRRset([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: name, Rrtype: rrType, Class: dns.ClassINET}}})
+
+	for _, target := range targets {
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", name, ttl, addrType, target))
+		if err != nil {
+			return err
+		}
+		m.Insert([]dns.RR{rr})
+	}
+
+	return r.send(m)
+}
+
+// AddRecord inserts a single record without touching the rest of its rrset.
+func (r *RFC2136) AddRecord(hostname string, target string, addrType string, zone string, ttl int) error {
+	log.Info(fmt.Sprintf("%s record add request: %s -> %s", addrType, hostname, target))
+
+	rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(hostname+"."+zone), ttl, addrType, target))
+	if err != nil {
+		return err
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone))
+	m.Insert([]dns.RR{rr})
+
+	return r.send(m)
+}
+
+// RemoveRecord removes a single record without touching the rest of its rrset.
+func (r *RFC2136) RemoveRecord(hostname string, target string, addrType string, zone string) error {
+	log.Info(fmt.Sprintf("%s record remove request: %s -> %s", addrType, hostname, target))
+
+	rr, err := dns.NewRR(fmt.Sprintf("%s 0 IN %s %s", dns.Fqdn(hostname+"."+zone), addrType, target))
+	if err != nil {
+		return err
+	}
+
+	m := new(dns.Msg)
+	m.SetUpdate(dns.Fqdn(zone))
+	m.Remove([]dns.RR{rr})
+
+	return r.send(m)
+}
+
+// ListRecords requests a zone transfer and returns all records of the zone.
+// The name server has to allow zone transfers to the dyndns server.
+func (r *RFC2136) ListRecords(zone string) ([]Record, error) {
+	m := new(dns.Msg)
+	m.SetAxfr(dns.Fqdn(zone))
+
+	t := &dns.Transfer{DialTimeout: r.Timeout, ReadTimeout: r.Timeout, WriteTimeout: r.Timeout}
+	if r.TsigKeyName != "" {
+		t.TsigSecret = map[string]string{dns.Fqdn(r.TsigKeyName): r.TsigSecret}
+		m.SetTsig(dns.Fqdn(r.TsigKeyName), dns.HmacSHA256, 300, time.Now().Unix())
+	}
+
+	envelopes, err := t.In(m, r.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []Record{}
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, envelope.Error
+		}
+
+		for _, rr := range envelope.RR {
+			header := rr.Header()
+			records = append(records, Record{
+				Name:   header.Name,
+				Ttl:    int(header.Ttl),
+				Type:   dns.TypeToString[header.Rrtype],
+				Target: strings.TrimPrefix(rr.String(), header.String()),
+			})
+		}
+	}
+
+	return records, nil
+}
+
+// send signs the update message if a TSIG key is configured and sends it to the name server.
+func (r *RFC2136) send(m *dns.Msg) error {
+	c := &dns.Client{Net: "tcp", Timeout: r.Timeout}
+	if r.TsigKeyName != "" {
+		c.TsigSecret = map[string]string{dns.Fqdn(r.TsigKeyName): r.TsigSecret}
+		m.SetTsig(dns.Fqdn(r.TsigKeyName), dns.HmacSHA256, 300, time.Now().Unix())
+	}
+
+	resp, _, err := c.Exchange(m, r.Server)
+	if err != nil {
+		return err
+	}
+
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("dns update failed: %s", dns.RcodeToString[resp.Rcode])
+	}
+
+	return nil
+}
+
+// joinHostPort appends the default DNS port to server if it has none.
+func joinHostPort(server string, port string) string {
+	if port == "" {
+		port = "53"
+	}
+
+	if _, _, err := net.SplitHostPort(server); err == nil {
+		return server
+	}
+
+	return net.JoinHostPort(server, port)
+}
@@ -0,0 +1,130 @@
+package nswrapper
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	testKeyName = "dyndns."
+	testSecret  = "c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0c2VjcmV0"
+)
+
+// startTestServer starts a tcp name server which records the received update messages.
+func startTestServer(t *testing.T, rcode int) (string, chan *dns.Msg) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	received := make(chan *dns.Msg, 1)
+	server := &dns.Server{
+		Listener:   listener,
+		TsigSecret: map[string]string{testKeyName: testSecret},
+		// the default accept func rejects update messages
+		MsgAcceptFunc: func(dh dns.Header) dns.MsgAcceptAction { return dns.MsgAccept },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			if r.IsTsig() == nil || w.TsigStatus() != nil {
+				m := new(dns.Msg)
+				m.SetRcode(r, dns.RcodeNotAuth)
+				w.WriteMsg(m)
+				return
+			}
+
+			received <- r
+			m := new(dns.Msg)
+			m.SetRcode(r, rcode)
+			m.SetTsig(testKeyName, dns.HmacSHA256, 300, time.Now().Unix())
+			w.WriteMsg(m)
+		}),
+	}
+
+	go server.ActivateAndServe()
+	t.Cleanup(func() { server.Shutdown() })
+
+	return listener.Addr().String(), received
+}
+
+func TestRFC2136UpdateRecordToSendSignedDeleteAndAdd(t *testing.T) {
+	addr, received := startTestServer(t, dns.RcodeSuccess)
+	backend := &RFC2136{Server: addr, TsigKeyName: "dyndns", TsigSecret: testSecret, Timeout: time.Second}
+
+	if err := backend.UpdateRecord("blog", "1.2.3.4", "A", "dyndns.example.com", 60, true); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	m := <-received
+	if m.Question[0].Name != "dyndns.example.com." {
+		t.Fatalf("Expected zone dyndns.example.com. but got %s", m.Question[0].Name)
+	}
+
+	if len(m.Ns) != 4 {
+		t.Fatalf("Expected 4 update records but got %d", len(m.Ns))
+	}
+
+	for i, name := range []string{"blog.dyndns.example.com.", "*.blog.dyndns.example.com."} {
+		del := m.Ns[i].Header()
+		if del.Name != name || del.Class != dns.ClassANY || del.Rrtype != dns.TypeA {
+			t.Fatalf("Expected rrset delete of %s but got %v", name, m.Ns[i])
+		}
+
+		add, ok := m.Ns[i+2].(*dns.A)
+		if !ok || add.Hdr.Name != name || add.Hdr.Ttl != 60 || add.A.String() != "1.2.3.4" {
+			t.Fatalf("Expected A record of %s but got %v", name, m.Ns[i+2])
+		}
+	}
+}
+
+func TestRFC2136UpdateRecordSetToReplaceRRset(t *testing.T) {
+	addr, received := startTestServer(t, dns.RcodeSuccess)
+	backend := &RFC2136{Server: addr, TsigKeyName: "dyndns", TsigSecret: testSecret, Timeout: time.Second}
+
+	if err := backend.UpdateRecordSet("blog", []string{"10 mx1.example.com.", "20 mx2.example.com."}, "MX", "dyndns.example.com", 300); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	m := <-received
+	if len(m.Ns) != 3 || m.Ns[0].Header().Class != dns.ClassANY || m.Ns[0].Header().Rrtype != dns.TypeMX {
+		t.Fatalf("Expected rrset delete and 2 inserts but got %v", m.Ns)
+	}
+
+	if mx, ok := m.Ns[2].(*dns.MX); !ok || mx.Preference != 20 || mx.Mx != "mx2.example.com." || mx.Hdr.Ttl != 300 {
+		t.Fatalf("Expected MX 20 mx2.example.com. but got %v", m.Ns[2])
+	}
+}
+
+func TestRFC2136DeleteRecordToReturnErrorOnRefusedUpdate(t *testing.T) {
+	addr, _ := startTestServer(t, dns.RcodeRefused)
+	backend := &RFC2136{Server: addr, TsigKeyName: "dyndns", TsigSecret: testSecret, Timeout: time.Second}
+
+	if err := backend.DeleteRecord("blog", "dyndns.example.com", false); err == nil {
+		t.Fatalf("Expected an error but got nil")
+	}
+}
+
+func TestRFC2136AddRecordToInsertSingleRecord(t *testing.T) {
+	addr, received := startTestServer(t, dns.RcodeSuccess)
+	backend := &RFC2136{Server: addr, TsigKeyName: "dyndns", TsigSecret: testSecret, Timeout: time.Second}
+
+	if err := backend.AddRecord("_acme-challenge.blog", `"token"`, "TXT", "dyndns.example.com", 60); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	m := <-received
+	add, ok := m.Ns[0].(*dns.TXT)
+	if len(m.Ns) != 1 || !ok || add.Hdr.Name != "_acme-challenge.blog.dyndns.example.com." || add.Hdr.Class != dns.ClassINET || add.Txt[0] != "token" {
+		t.Fatalf("Expected single TXT record insert but got %v", m.Ns)
+	}
+
+	if err := backend.RemoveRecord("_acme-challenge.blog", `"token"`, "TXT", "dyndns.example.com"); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	m = <-received
+	if len(m.Ns) != 1 || m.Ns[0].Header().Class != dns.ClassNONE {
+		t.Fatalf("Expected single TXT record removal but got %v", m.Ns)
+	}
+}
@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limiter counts hits per key in fixed time windows, it is safe for concurrent use.
+// Expired keys are dropped lazily. A nil Limiter allows everything.
+type Limiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	counters map[string]*counter
+	cleanup  time.Time
+}
+
+type counter struct {
+	hits  int
+	reset time.Time
+}
+
+// New creates a limiter, which allows limit hits per key within window.
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{
+		limit:    limit,
+		window:   window,
+		now:      time.Now,
+		counters: map[string]*counter{},
+	}
+}
+
+// Parse creates a limiter from a rate like "10/5m", i.e. 10 hits per 5 minutes.
+// An empty rate, "0" and "off" disable the limit and return nil.
+func Parse(rate string) (*Limiter, error) {
+	if rate == "" || rate == "0" || rate == "off" {
+		return nil, nil
+	}
+
+	limitStr, windowStr, ok := strings.Cut(rate, "/")
+	if !ok {
+		return nil, fmt.Errorf("rate %q has to be of the form <hits>/<duration>", rate)
+	}
+
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit < 1 {
+		return nil, fmt.Errorf("rate %q has an invalid number of hits", rate)
+	}
+
+	window, err := time.ParseDuration(windowStr)
+	if err != nil || window <= 0 {
+		return nil, fmt.Errorf("rate %q has an invalid duration", rate)
+	}
+
+	return New(limit, window), nil
+}
+
+// Allow counts a hit of key and reports whether it is within the limit.
+func (l *Limiter) Allow(key string) bool {
+	if l == nil {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.dropExpired(now)
+
+	c, ok := l.counters[key]
+	if !ok || !now.Before(c.reset) {
+		c = &counter{reset: now.Add(l.window)}
+		l.counters[key] = c
+	}
+	c.hits++
+
+	return c.hits <= l.limit
+}
+
+// Exceeded reports whether key has used up its limit in the current window without counting a hit.
+func (l *Limiter) Exceeded(key string) bool {
+	if l == nil {
+		return false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.counters[key]
+
+	return ok && l.now().Before(c.reset) && c.hits >= l.limit
+}
+
+// Reset forgets all hits of key.
+func (l *Limiter) Reset(key string) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.counters, key)
+}
+
+// dropExpired removes the counters of past windows, at most once per window.
+func (l *Limiter) dropExpired(now time.Time) {
+	if now.Before(l.cleanup) {
+		return
+	}
+
+	for key, c := range l.counters {
+		if !now.Before(c.reset) {
+			delete(l.counters, key)
+		}
+	}
+	l.cleanup = now.Add(l.window)
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestLimiter creates a limiter with a clock, which is advanced by the returned function.
+func newTestLimiter(limit int, window time.Duration) (*Limiter, func(time.Duration)) {
+	l := New(limit, window)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	return l, func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestAllowToLimitHitsPerWindow(t *testing.T) {
+	l, advance := newTestLimiter(2, time.Minute)
+
+	if !l.Allow("a") || !l.Allow("a") {
+		t.Fatalf("Expected the first two hits to be allowed")
+	}
+
+	if l.Allow("a") {
+		t.Fatalf("Expected the third hit to be rejected")
+	}
+
+	if !l.Allow("b") {
+		t.Fatalf("Expected other keys to be counted separately")
+	}
+
+	advance(time.Minute)
+	if !l.Allow("a") {
+		t.Fatalf("Expected hits to be allowed again in the next window")
+	}
+}
+
+func TestExceededToNotCountHits(t *testing.T) {
+	l, advance := newTestLimiter(2, time.Minute)
+
+	l.Allow("a")
+	if l.Exceeded("a") || l.Exceeded("a") {
+		t.Fatalf("Expected limit not to be exceeded after one hit")
+	}
+
+	l.Allow("a")
+	if !l.Exceeded("a") {
+		t.Fatalf("Expected limit to be exceeded after two hits")
+	}
+
+	l.Reset("a")
+	if l.Exceeded("a") {
+		t.Fatalf("Expected limit not to be exceeded after reset")
+	}
+
+	l.Allow("a")
+	l.Allow("a")
+	advance(time.Minute)
+	if l.Exceeded("a") {
+		t.Fatalf("Expected limit not to be exceeded after the window")
+	}
+}
+
+func TestAllowToDropExpiredKeys(t *testing.T) {
+	l, advance := newTestLimiter(1, time.Minute)
+
+	l.Allow("a")
+	l.Allow("b")
+	advance(time.Minute)
+	l.Allow("c")
+
+	if len(l.counters) != 1 {
+		t.Fatalf("Expected expired keys to be dropped but got %d keys", len(l.counters))
+	}
+}
+
+func TestParseToCreateLimiter(t *testing.T) {
+	l, err := Parse("10/5m")
+	if err != nil || l.limit != 10 || l.window != 5*time.Minute {
+		t.Fatalf("Expected 10 hits per 5m but got %+v (%v)", l, err)
+	}
+
+	for _, rate := range []string{"", "0", "off"} {
+		if l, err := Parse(rate); l != nil || err != nil {
+			t.Fatalf("Expected %q to disable the limit but got %+v (%v)", rate, l, err)
+		}
+	}
+
+	for _, rate := range []string{"10", "x/5m", "0/5m", "10/x", "10/-1m"} {
+		if _, err := Parse(rate); err == nil {
+			t.Fatalf("Expected %q to be invalid", rate)
+		}
+	}
+
+	var disabled *Limiter
+	if !disabled.Allow("a") || disabled.Exceeded("a") {
+		t.Fatalf("Expected a nil limiter to allow everything")
+	}
+}
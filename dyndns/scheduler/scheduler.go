@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/labstack/gommon/log"
+)
+
+// Job is a task run periodically by the scheduler.
+type Job func(ctx context.Context) error
+
+type entry struct {
+	name     string
+	interval time.Duration
+	job      Job
+}
+
+// Scheduler runs jobs in the background, each in its own interval.
+// A job never runs concurrently with itself, runs which are due while the previous run is still busy are skipped.
+type Scheduler struct {
+	jobs   []entry
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New creates an empty scheduler.
+func New() *Scheduler {
+	return &Scheduler{}
+}
+
+// Add registers job to run every interval, after Start has been called.
+// Jobs with an interval <= 0 are ignored.
+func (s *Scheduler) Add(name string, interval time.Duration, job Job) {
+	if interval <= 0 {
+		return
+	}
+
+	s.jobs = append(s.jobs, entry{name: name, interval: interval, job: job})
+}
+
+// Start runs all jobs until ctx is done or Stop is called.
+// Each job runs once right away and then every interval.
+func (s *Scheduler) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	for _, e := range s.jobs {
+		s.wg.Add(1)
+		go func(e entry) {
+			defer s.wg.Done()
+			s.loop(ctx, e)
+		}(e)
+	}
+}
+
+// Stop cancels the context of all jobs and waits for running jobs to return.
+func (s *Scheduler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, e entry) {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := e.job(ctx); err != nil && ctx.Err() == nil {
+			log.Error("Error running job ", e.name, ": ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
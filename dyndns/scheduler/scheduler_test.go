@@ -0,0 +1,59 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerToRunJobsRepeatedly(t *testing.T) {
+	var runs, failures int32
+	s := New()
+	s.Add("count", time.Millisecond, func(ctx context.Context) error {
+		atomic.AddInt32(&runs, 1)
+		return nil
+	})
+	s.Add("fail", time.Millisecond, func(ctx context.Context) error {
+		atomic.AddInt32(&failures, 1)
+		return errors.New("failed")
+	})
+	s.Add("disabled", 0, func(ctx context.Context) error {
+		t.Error("Expected job without interval not to run")
+		return nil
+	})
+
+	s.Start(context.Background())
+	time.Sleep(20 * time.Millisecond)
+	s.Stop()
+
+	if atomic.LoadInt32(&runs) < 2 || atomic.LoadInt32(&failures) < 2 {
+		t.Fatalf("Expected jobs to run repeatedly but got %d and %d runs", runs, failures)
+	}
+}
+
+func TestStopToWaitForRunningJobs(t *testing.T) {
+	started := make(chan struct{})
+	var finished int32
+	s := New()
+	s.Add("slow", time.Hour, func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		atomic.StoreInt32(&finished, 1)
+		return ctx.Err()
+	})
+
+	s.Start(context.Background())
+	<-started
+	s.Stop()
+
+	if atomic.LoadInt32(&finished) != 1 {
+		t.Fatal("Expected Stop to wait for the running job")
+	}
+}
+
+func TestStopToReturnWithoutStart(t *testing.T) {
+	New().Stop()
+}
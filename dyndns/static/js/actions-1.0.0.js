@@ -9,8 +9,8 @@ $("button.editHost").click(function () {
 $("button.deleteHost").click(function () {
     $.ajax({
         contentType: 'application/x-www-form-urlencoded; charset=UTF-8',
-        type: 'GET',
-        url: "/admin/hosts/delete/" + $(this).attr('id')
+        type: 'DELETE',
+        url: "/api/v1/hosts/" + $(this).attr('id')
     }).done(function(data, textStatus, jqXHR) {
         location.href="/admin/hosts";
     }).fail(function(jqXHR, textStatus, errorThrown) {
@@ -47,6 +47,10 @@ $("button.add, button.edit").click(function () {
         type = "cnames";
     }
 
+    if ($(this).hasClass("record")) {
+        type = "records";
+    }
+
     $('#domain').prop('disabled', false);
 
     $.ajax({
@@ -97,8 +101,8 @@ $("button.addCName").click(function () {
 $("button.deleteCName").click(function () {
     $.ajax({
         contentType: 'application/x-www-form-urlencoded; charset=UTF-8',
-        type: 'GET',
-        url: "/admin/cnames/delete/" + $(this).attr('id')
+        type: 'DELETE',
+        url: "/api/v1/cnames/" + $(this).attr('id')
     }).done(function(data, textStatus, jqXHR) {
         location.href="/admin/cnames";
     }).fail(function(jqXHR, textStatus, errorThrown) {
@@ -107,6 +111,160 @@ $("button.deleteCName").click(function () {
     });
 });
 
+$("button.addRecord").click(function () {
+    location.href='/admin/records/add';
+});
+
+$("button.deleteRecord").click(function () {
+    $.ajax({
+        type: 'DELETE',
+        url: "/api/v1/records/" + $(this).attr('id')
+    }).done(function(data, textStatus, jqXHR) {
+        location.href="/admin/records";
+    }).fail(function(jqXHR, textStatus, errorThrown) {
+        alert("Error: " + $.parseJSON(jqXHR.responseText).message);
+        location.reload()
+    });
+});
+
+// recordTypeSelected shows the fields used by the selected record type.
+function recordTypeSelected() {
+    let type = $('#record-type').val();
+    $('.record-field').hide();
+    $('.record-' + type.toLowerCase()).show();
+}
+
+$("button.addToken").click(function () {
+    let scopes = $("input.token-scope:checked").map(function () {
+        return $(this).val();
+    }).get();
+
+    $.ajax({
+        contentType: 'application/json; charset=UTF-8',
+        data: JSON.stringify({name: $('#token-name').val(), scopes: scopes}),
+        type: 'POST',
+        url: '/api/v1/tokens',
+    }).done(function(data, textStatus, jqXHR) {
+        $('#new-token').val(data.token);
+        $('#new-token-row').show();
+        $('button.addToken').hide();
+    }).fail(function(jqXHR, textStatus, errorThrown) {
+        alert("Error: " + $.parseJSON(jqXHR.responseText).message);
+    });
+
+    return false;
+});
+
+$("button.revokeToken").click(function () {
+    if (!confirm("Revoke this API token?")) {
+        return;
+    }
+
+    $.ajax({
+        type: 'DELETE',
+        url: "/api/v1/tokens/" + $(this).attr('id')
+    }).done(function(data, textStatus, jqXHR) {
+        location.href="/admin/tokens";
+    }).fail(function(jqXHR, textStatus, errorThrown) {
+        alert("Error: " + $.parseJSON(jqXHR.responseText).message);
+        location.reload()
+    });
+});
+
+$("button.addUser").click(function () {
+    let domains = $("input.user-domain:checked").map(function () {
+        return $(this).val();
+    }).get();
+
+    $.ajax({
+        contentType: 'application/json; charset=UTF-8',
+        data: JSON.stringify({
+            username: $('#user-name').val(),
+            password: $('#user-password').val(),
+            role: $('#user-role').val(),
+            tenant: $('#user-tenant').is(':checked'),
+            domains: domains
+        }),
+        type: 'POST',
+        url: '/api/v1/users',
+    }).done(function(data, textStatus, jqXHR) {
+        location.href="/admin/users";
+    }).fail(function(jqXHR, textStatus, errorThrown) {
+        alert("Error: " + $.parseJSON(jqXHR.responseText).message);
+    });
+
+    return false;
+});
+
+$("select.changeUserRole").change(function () {
+    $.ajax({
+        contentType: 'application/json; charset=UTF-8',
+        data: JSON.stringify({role: $(this).val()}),
+        type: 'PATCH',
+        url: "/api/v1/users/" + $(this).attr('id')
+    }).fail(function(jqXHR, textStatus, errorThrown) {
+        alert("Error: " + $.parseJSON(jqXHR.responseText).message);
+        location.reload()
+    });
+});
+
+$("button.deleteUser").click(function () {
+    if (!confirm("Delete this admin user?")) {
+        return;
+    }
+
+    $.ajax({
+        type: 'DELETE',
+        url: "/api/v1/users/" + $(this).attr('id')
+    }).done(function(data, textStatus, jqXHR) {
+        location.href="/admin/users";
+    }).fail(function(jqXHR, textStatus, errorThrown) {
+        alert("Error: " + $.parseJSON(jqXHR.responseText).message);
+        location.reload()
+    });
+});
+
+$("button.addWebhook").click(function () {
+    let events = $("input.webhook-event:checked").map(function () {
+        return $(this).val();
+    }).get();
+
+    $.ajax({
+        contentType: 'application/json; charset=UTF-8',
+        data: JSON.stringify({
+            url: $('#webhook-url').val(),
+            host_id: parseInt($('#webhook-host').val()),
+            events: events
+        }),
+        type: 'POST',
+        url: '/api/v1/webhooks',
+    }).done(function(data, textStatus, jqXHR) {
+        $('#new-webhook-secret').val(data.secret);
+        $('#new-webhook-row').show();
+        $('button.addWebhook').hide();
+    }).fail(function(jqXHR, textStatus, errorThrown) {
+        alert("Error: " + $.parseJSON(jqXHR.responseText).message);
+    });
+
+    return false;
+});
+
+$("button.deleteWebhook").click(function () {
+    if (!confirm("Delete this webhook?")) {
+        return;
+    }
+
+    $.ajax({
+        type: 'DELETE',
+        url: "/api/v1/webhooks/" + $(this).attr('id')
+    }).done(function(data, textStatus, jqXHR) {
+        location.href="/admin/webhooks";
+    }).fail(function(jqXHR, textStatus, errorThrown) {
+        alert("Error: " + $.parseJSON(jqXHR.responseText).message);
+        location.reload()
+    });
+});
+
 function newTargetSelected() {
     var sel = document.getElementById("target_id");
     var x = sel.options[sel.selectedIndex].label.replace(sel.options[sel.selectedIndex].text, '');
@@ -131,8 +289,8 @@ $("button.copyUrlToClipboard").click(function () {
     let hostname = document.getElementById('host-hostname_'+id).innerHTML
     let domain = document.getElementById('host-domain_'+id).innerHTML
     let username = document.getElementById('host-username_'+id).innerHTML
-    let password = document.getElementById('host-password_'+id).innerHTML
-    let out = location.protocol + '//' +username.trim()+':'+password.trim()+'@'+ domain
+    // passwords are stored hashed, so only a placeholder can be copied
+    let out = location.protocol + '//' +username.trim()+':PASSWORD@'+ domain
     out +='/update?hostname='+hostname
 
     let dummy = document.createElement("textarea");
@@ -180,4 +338,8 @@ $(document).ready(function(){
         urlPath = "hosts"
     }
     document.getElementsByClassName("nav-"+urlPath)[0].classList.add("active");
+
+    if ($('#record-type').length) {
+        recordTypeSelected();
+    }
 });
@@ -0,0 +1,177 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"github.com/labstack/gommon/log"
+	"gorm.io/gorm"
+)
+
+// Headers of a delivery, the signature is the hex encoded HMAC-SHA256 of the body: "sha256=<hex>".
+const (
+	SignatureHeader = "X-DDNS-Signature"
+	EventHeader     = "X-DDNS-Event"
+	DeliveryHeader  = "X-DDNS-Delivery"
+)
+
+// Event is the json payload posted to webhooks.
+type Event struct {
+	Event     string    `json:"event"`
+	HostID    uint      `json:"host_id"`
+	Host      string    `json:"host"`
+	OldIP     string    `json:"old_ip"`
+	NewIP     string    `json:"new_ip"`
+	CallerIP  string    `json:"caller_ip"`
+	Message   string    `json:"message,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Sign returns the signature header of body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher delivers events to the subscribed webhooks in the background.
+// Failed deliveries are retried with exponential backoff, every attempt is logged as model.WebhookDelivery.
+// A nil Dispatcher drops all events.
+type Dispatcher struct {
+	DB       *gorm.DB
+	Client   *http.Client
+	Attempts int
+	Backoff  time.Duration
+
+	wg      sync.WaitGroup
+	done    chan struct{}
+	closing sync.Once
+}
+
+// NewDispatcher creates a dispatcher, which tries each delivery 5 times starting with 10 seconds backoff.
+func NewDispatcher(db *gorm.DB) *Dispatcher {
+	return &Dispatcher{
+		DB:       db,
+		Client:   &http.Client{Timeout: 10 * time.Second},
+		Attempts: 5,
+		Backoff:  10 * time.Second,
+		done:     make(chan struct{}),
+	}
+}
+
+// Dispatch delivers event to all webhooks of its host and all global webhooks subscribed to it.
+func (d *Dispatcher) Dispatch(event Event) {
+	if d == nil {
+		return
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	webhooks := []model.Webhook{}
+	if err := d.DB.Where("host_id = 0 OR host_id = ?", event.HostID).Find(&webhooks).Error; err != nil {
+		log.Error("Error finding webhooks: ", err)
+		return
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Error("Error encoding webhook event: ", err)
+		return
+	}
+
+	for i := range webhooks {
+		webhook := webhooks[i]
+		if !webhook.HasEvent(event.Event) {
+			continue
+		}
+
+		delivery := &model.WebhookDelivery{WebhookID: webhook.ID, Event: event.Event, Host: event.Host, Payload: string(body)}
+		if err = d.DB.Create(delivery).Error; err != nil {
+			log.Error("Error logging webhook delivery: ", err)
+			continue
+		}
+
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.deliver(&webhook, delivery, body)
+		}()
+	}
+}
+
+// Close stops retrying deliveries and waits for running requests to finish.
+func (d *Dispatcher) Close() {
+	if d == nil {
+		return
+	}
+
+	d.closing.Do(func() { close(d.done) })
+	d.wg.Wait()
+}
+
+// deliver posts body to webhook until it succeeds or all attempts failed.
+func (d *Dispatcher) deliver(webhook *model.Webhook, delivery *model.WebhookDelivery, body []byte) {
+	backoff := d.Backoff
+	for delivery.Attempts < d.Attempts {
+		delivery.Attempts++
+		delivery.StatusCode, delivery.Error = 0, ""
+
+		status, err := d.post(webhook, delivery, body)
+		delivery.StatusCode = status
+		delivery.Success = err == nil
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+
+		if err = d.DB.Save(delivery).Error; err != nil {
+			log.Error("Error logging webhook delivery: ", err)
+		}
+
+		if delivery.Success || delivery.Attempts >= d.Attempts {
+			return
+		}
+
+		select {
+		case <-d.done:
+			return
+		case <-time.After(backoff):
+			backoff *= 2
+		}
+	}
+}
+
+// post sends a single signed request and returns the response status.
+func (d *Dispatcher) post(webhook *model.Webhook, delivery *model.WebhookDelivery, body []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(webhook.Secret, body))
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(DeliveryHeader, strconv.FormatUint(uint64(delivery.ID), 10))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,116 @@
+package webhook
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/benjaminbear/docker-ddns-server/dyndns/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	sqlDB, _ := db.DB()
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err = db.AutoMigrate(&model.Webhook{}, &model.WebhookDelivery{}); err != nil {
+		t.Fatalf("Expected no error but got %v", err)
+	}
+
+	return db
+}
+
+func TestDispatchToSignAndRetryDelivery(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(SignatureHeader) != Sign("0123456789abcdef", body) || r.Header.Get(EventHeader) != model.EventIPChange {
+			t.Errorf("Expected signed ip_change delivery but got headers %v", r.Header)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	db := newTestDB(t)
+	db.Create(&model.Webhook{URL: srv.URL, Secret: "0123456789abcdef", Events: model.EventIPChange})
+	db.Create(&model.Webhook{URL: srv.URL, Secret: "0123456789abcdef", Events: model.EventHostDeleted})
+	db.Create(&model.Webhook{URL: srv.URL, Secret: "0123456789abcdef", HostID: 2})
+
+	d := NewDispatcher(db)
+	d.Backoff = time.Millisecond
+	d.Dispatch(Event{Event: model.EventIPChange, HostID: 1, Host: "blog.dyndns.example.com", NewIP: "1.2.3.4"})
+	d.wg.Wait()
+
+	deliveries := []model.WebhookDelivery{}
+	db.Find(&deliveries)
+	if len(deliveries) != 1 || !deliveries[0].Success || deliveries[0].Attempts != 2 || deliveries[0].StatusCode != http.StatusOK {
+		t.Fatalf("Expected one successful delivery after 2 attempts but got %+v", deliveries)
+	}
+}
+
+func TestDispatchToGiveUpAfterAllAttempts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	db := newTestDB(t)
+	db.Create(&model.Webhook{URL: srv.URL, Secret: "0123456789abcdef"})
+
+	d := NewDispatcher(db)
+	d.Attempts = 3
+	d.Backoff = time.Millisecond
+	d.Dispatch(Event{Event: model.EventUpdateFailed, HostID: 1})
+	d.wg.Wait()
+
+	delivery := &model.WebhookDelivery{}
+	db.First(delivery)
+	if delivery.Success || delivery.Attempts != 3 || delivery.StatusCode != http.StatusBadGateway || delivery.Error == "" {
+		t.Fatalf("Expected failed delivery after 3 attempts but got %+v", delivery)
+	}
+}
+
+func TestDispatchToIgnoreNilDispatcher(t *testing.T) {
+	var d *Dispatcher
+	d.Dispatch(Event{Event: model.EventIPChange})
+	d.Close()
+}
+
+func TestCloseToStopRetries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	db := newTestDB(t)
+	db.Create(&model.Webhook{URL: srv.URL, Secret: "0123456789abcdef"})
+
+	d := NewDispatcher(db)
+	d.Backoff = time.Hour
+	d.Dispatch(Event{Event: model.EventUpdateFailed, HostID: 1})
+	d.Close()
+
+	delivery := &model.WebhookDelivery{}
+	db.First(delivery)
+	if delivery.Success || delivery.Attempts != 1 {
+		t.Fatalf("Expected a single failed attempt but got %+v", delivery)
+	}
+}